@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// readData reads the data of a render from a file, or from stdin for "-".
+// The format is taken from the file extension unless it is given.
+func readData(name, format string, stdin io.Reader) (interface{}, error) {
+	if format == "" {
+		if name == "-" {
+			return nil, usageError("-format is needed to read data from stdin")
+		}
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch format {
+	case "json":
+		v, err = parseJSON(data)
+	case "yaml", "yml":
+		v, err = parseYAML(data)
+	case "csv":
+		v, err = parseCSV(data)
+	default:
+		return nil, usageError(fmt.Sprintf("unknown data format %q, expected json, yaml or csv", format))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return v, nil
+}
+
+// parseJSON parses JSON data. Numbers are kept as json.Number, so large
+// integers like invoice numbers are rendered as they are written.
+func parseJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+// parseCSV returns the records of a CSV file, whose first row names the
+// values. Dotted names like "customer.name" are stored in nested records.
+func parseCSV(data []byte) ([]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no header row")
+	}
+	records := []interface{}{}
+	for _, row := range rows[1:] {
+		record := make(map[string]interface{})
+		for i, name := range rows[0] {
+			if err := setValue(record, strings.TrimSpace(name), row[i]); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// setValue sets the value of a dotted path like "customer.name", adding nested records as needed.
+func setValue(record map[string]interface{}, path, value string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, ok := record[name].(map[string]interface{})
+		if !ok {
+			if _, exists := record[name]; exists {
+				return fmt.Errorf("%s: %s is not a record", path, name)
+			}
+			nested = make(map[string]interface{})
+			record[name] = nested
+		}
+		record = nested
+	}
+	record[names[len(names)-1]] = value
+	return nil
+}
+
+// value is a single -set flag.
+type value struct {
+	path, value string
+}
+
+// apply sets the value in the data, or in each of its records.
+func (v value) apply(data interface{}) error {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		return setValue(data, v.path, v.value)
+	case []interface{}:
+		for _, record := range data {
+			if err := v.apply(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot set %s, the data is not a record", v.path)
+}
+
+// valueFlags collects the -set flags.
+type valueFlags []value
+
+func (f *valueFlags) String() string {
+	var values []string
+	for _, v := range *f {
+		values = append(values, v.path+"="+v.value)
+	}
+	return strings.Join(values, " ")
+}
+
+func (f *valueFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	*f = append(*f, value{path: s[:i], value: s[i+1:]})
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"docx"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var inspectCommand = &command{
+	name:    "inspect",
+	args:    "template.docx",
+	summary: "list the parts, relationships, properties and placeholders of a docx",
+	doc: "Inspect lists the files of a docx with their sizes and content types, the relationships\n" +
+		"between them, the document properties and the placeholders, loops and conditions of\n" +
+		"the template. It warns about placeholders split across runs, unbalanced region markers\n" +
+		"and relationships to missing parts.",
+	setup: setupInspect,
+}
+
+// inspection is the result of the inspect command, written as JSON with -json.
+type inspection struct {
+	Parts         []docx.PackagePart  `json:"parts"`
+	Relationships []docx.Relationship `json:"relationships"`
+	Properties    []property          `json:"properties"`
+	Structure     *docx.Structure     `json:"structure,omitempty"` // missing if the template cannot be parsed
+	Warnings      []docx.Warning      `json:"warnings"`
+}
+
+// property is a core, application or custom property of the document.
+type property struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Custom bool        `json:"custom,omitempty"`
+}
+
+func setupInspect(fs *flag.FlagSet) func(ctx context.Context, env *environment, args []string) error {
+	asJSON := fs.Bool("json", false, "write the result as JSON")
+	return func(ctx context.Context, env *environment, args []string) error {
+		if len(args) != 1 {
+			return usageError("expected a docx")
+		}
+		r, err := docx.ReadDocxFile(args[0])
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		result := inspect(r.Editable())
+		if *asJSON {
+			encoder := json.NewEncoder(env.stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		}
+		return result.write(env.stdout)
+	}
+}
+
+// inspect lists what can be read of a docx. Parts that cannot be read
+// are reported as warnings, so the rest is still listed.
+func inspect(d *docx.Docx) *inspection {
+	result := &inspection{Warnings: d.Lint()}
+	warn := func(part string, err error) {
+		result.Warnings = append(result.Warnings, docx.Warning{
+			Location: docx.Location{Part: part, Paragraph: -1},
+			Message:  strings.TrimPrefix(err.Error(), part+": "),
+		})
+	}
+	var err error
+	if result.Parts, err = d.PackageParts(); err != nil {
+		warn("[Content_Types].xml", err)
+	}
+	// the relationships that can be read are listed, Lint has reported the others
+	result.Relationships, _ = d.Relationships()
+	if core, err := d.CoreProperties(); err != nil {
+		warn("docProps/core.xml", err)
+	} else {
+		result.Properties = append(result.Properties, coreProperties(core)...)
+	}
+	if app, err := d.AppProperties(); err != nil {
+		warn("docProps/app.xml", err)
+	} else {
+		result.Properties = append(result.Properties, appProperties(app)...)
+	}
+	if custom, err := d.CustomProperties(); err != nil {
+		warn("docProps/custom.xml", err)
+	} else {
+		result.Properties = append(result.Properties, customProperties(custom)...)
+	}
+	// a template that cannot be parsed has no structure, Lint has reported why
+	result.Structure, _ = d.Inspect()
+	return result
+}
+
+// coreProperties returns the core properties that are set.
+func coreProperties(core *docx.CoreProperties) []property {
+	return setProperties([]property{
+		{Name: "title", Value: core.Title},
+		{Name: "subject", Value: core.Subject},
+		{Name: "creator", Value: core.Creator},
+		{Name: "keywords", Value: core.Keywords},
+		{Name: "description", Value: core.Description},
+		{Name: "lastModifiedBy", Value: core.LastModifiedBy},
+		{Name: "category", Value: core.Category},
+		{Name: "revision", Value: core.Revision},
+		{Name: "created", Value: core.Created},
+		{Name: "modified", Value: core.Modified},
+	})
+}
+
+// appProperties returns the application-specific properties that are set.
+func appProperties(app *docx.AppProperties) []property {
+	return setProperties([]property{
+		{Name: "company", Value: app.Company},
+		{Name: "manager", Value: app.Manager},
+		{Name: "template", Value: app.Template},
+	})
+}
+
+// setProperties returns the properties that are not empty or zero.
+func setProperties(properties []property) []property {
+	var result []property
+	for _, p := range properties {
+		switch v := p.Value.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+		case int:
+			if v == 0 {
+				continue
+			}
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// customProperties returns the custom properties sorted by name.
+func customProperties(custom map[string]interface{}) []property {
+	var names []string
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result []property
+	for _, name := range names {
+		result = append(result, property{Name: name, Value: custom[name], Custom: true})
+	}
+	return result
+}
+
+// write writes the inspection as text.
+func (result *inspection) write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Parts:")
+	for _, p := range result.Parts {
+		size := fmt.Sprintf("%d bytes", p.Size)
+		if p.CompressedSize != 0 {
+			size += fmt.Sprintf(" (%d compressed)", p.CompressedSize)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", p.Name, p.ContentType, size)
+	}
+
+	fmt.Fprintln(w, "\nRelationships:")
+	for _, rel := range result.Relationships {
+		source := rel.Source
+		if source == "" {
+			source = "package"
+		}
+		target := rel.Target
+		if rel.External {
+			target += " (external)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t-> %s\n", source, rel.ID, path.Base(rel.Type), target)
+	}
+
+	fmt.Fprintln(w, "\nProperties:")
+	for _, p := range result.Properties {
+		name := p.Name
+		if p.Custom {
+			name += " (custom)"
+		}
+		value := p.Value
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "  %s\t%v\n", name, value)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\nPlaceholders:")
+	if result.Structure != nil {
+		writeStructure(out, result.Structure, "  ")
+	} else {
+		fmt.Fprintln(out, "  the template cannot be parsed, see the warnings")
+	}
+
+	fmt.Fprintln(out, "\nWarnings:")
+	for _, warning := range result.Warnings {
+		if l := location(warning.Location); l != "" {
+			fmt.Fprintf(out, "  %s: %s\n", l, warning.Message)
+		} else {
+			fmt.Fprintf(out, "  %s\n", warning.Message)
+		}
+	}
+	if len(result.Warnings) == 0 {
+		fmt.Fprintln(out, "  none")
+	}
+	return nil
+}
+
+// writeStructure writes the placeholders, loops and conditions of a template, indenting the content of regions.
+func writeStructure(w io.Writer, s *docx.Structure, indent string) {
+	for _, p := range s.Placeholders {
+		fmt.Fprintf(w, "%s«%s»  %s\n", indent, p.Name, location(p.Location))
+	}
+	for _, region := range s.Loops {
+		fmt.Fprintf(w, "%sloop %s  %s\n", indent, region.Name, location(region.Location))
+		writeStructure(w, &region.Structure, indent+"  ")
+	}
+	for _, region := range s.Conditions {
+		fmt.Fprintf(w, "%sif %s  %s\n", indent, region.Name, location(region.Location))
+		writeStructure(w, &region.Structure, indent+"  ")
+	}
+}
+
+// location describes where something is found, with paragraphs numbered from 1.
+func location(l docx.Location) string {
+	if l.Paragraph < 0 {
+		return l.Part
+	}
+	text := l.Text
+	if len([]rune(text)) > 40 {
+		text = string([]rune(text)[:40]) + "…"
+	}
+	return fmt.Sprintf("%s, paragraph %d %q", l.Part, l.Paragraph+1, strings.TrimSpace(text))
+}
@@ -0,0 +1,154 @@
+// Command docx renders and inspects docx templates from the command line.
+//
+// Usage:
+//
+//	docx render [flags] template.docx [data.json|data.yaml|data.csv]
+//	docx inspect [-json] template.docx
+//
+// Run "docx help render" for the flags of a command.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// command is a subcommand like "docx render".
+type command struct {
+	name    string
+	args    string // arguments shown in the usage
+	summary string // a line for the list of commands
+	doc     string // the description shown in the usage of the command
+	// setup defines the flags of the command and returns the function
+	// that runs it with the remaining arguments.
+	setup func(fs *flag.FlagSet) func(ctx context.Context, env *environment, args []string) error
+}
+
+// environment holds the streams of a command, to replace them in tests.
+type environment struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+var commands = []*command{renderCommand, inspectCommand}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, &environment{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command given by args and returns the exit code:
+// 1 if the command fails and 2 if it is used wrongly.
+func run(ctx context.Context, env *environment, args []string) int {
+	if len(args) == 0 {
+		usage(env.stderr)
+		return 2
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 {
+			if c := lookupCommand(args[1]); c != nil {
+				fs := c.flagSet(env.stdout)
+				c.setup(fs)
+				fs.Usage()
+				return 0
+			}
+		}
+		usage(env.stdout)
+		return 0
+	}
+	c := lookupCommand(name)
+	if c == nil {
+		fmt.Fprintf(env.stderr, "docx: unknown command %q\n", name)
+		usage(env.stderr)
+		return 2
+	}
+	fs := c.flagSet(env.stderr)
+	runCommand := c.setup(fs)
+	args, err := parseFlags(fs, args[1:])
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		// the flag set has reported the error
+		return 2
+	}
+	err = runCommand(ctx, env, args)
+	if _, ok := err.(usageError); ok {
+		fmt.Fprintf(env.stderr, "docx %s: %v\n", c.name, err)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(env.stderr, "docx %s: %v\n", c.name, err)
+		return 1
+	}
+	return 0
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: docx <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "docx help <command>" for the flags of a command.`)
+}
+
+// usageError is returned by commands that are used wrongly.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// flagSet returns an empty flag set for the command that reports to w.
+func (c *command) flagSet(w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintf(w, "Usage: docx %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.doc)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses flags that may be given before, between and after the
+// arguments, e.g. "docx render template.docx data.json -o out.docx".
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "-" || !strings.HasPrefix(args[0], "-") {
+			positional = append(positional, args[0])
+			args = args[1:]
+			continue
+		}
+		// "--" ends the flags
+		return append(positional, args...), nil
+	}
+}
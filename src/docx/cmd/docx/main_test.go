@@ -0,0 +1,242 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"docx"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+	`<w:p><w:r><w:t>Dear «customer.name»,</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«start:items»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«article»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«end:items»</w:t></w:r></w:p>` +
+	`<w:sectPr/></w:body></w:document>`
+
+// writeTemplate writes a template to dir and returns its path.
+func writeTemplate(t *testing.T, dir string) string {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="xml" ContentType="application/xml"/></Types>`,
+		"word/document.xml": testDocument,
+	} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "template.docx")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCommand runs the command with the given stdin and returns the exit code and the output.
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := &environment{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	code := run(context.Background(), env, args)
+	return code, stdout.String(), stderr.String()
+}
+
+var textPattern = regexp.MustCompile(`<w:t[^>]*>([^<]*)</w:t>`)
+
+// documentText returns the text of the main document of a docx.
+func documentText(t *testing.T, data []byte) string {
+	r, err := docx.ReadDoxFileFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var text []string
+	for _, m := range textPattern.FindAllStringSubmatch(r.Editable().Content, -1) {
+		text = append(text, m[1])
+	}
+	return strings.Join(text, "|")
+}
+
+func TestRenderJSON(t *testing.T) {
+	dir := t.TempDir()
+	template := writeTemplate(t, dir)
+	data := filepath.Join(dir, "data.json")
+	ioutil.WriteFile(data, []byte(`{"customer": {"name": "Arthur"}, "items": [{"article": "Towel"}, {"article": "Guide"}]}`), 0666)
+	out := filepath.Join(dir, "out.docx")
+
+	code, _, stderr := runCommand("", "render", template, data, "-o", out, "-strict")
+	if code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Dear |Arthur|,|Towel|Guide", documentText(t, content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderJSONNumbers(t *testing.T) {
+	dir := t.TempDir()
+	template := writeTemplate(t, dir)
+	out := filepath.Join(dir, "out.docx")
+	data := `{"customer": {"name": 12345678}, "items": [{"article": 1.5}, {"article": 90071992547409930}]}`
+	code, _, stderr := runCommand(data, "render", template, "-", "-format", "json", "-o", out)
+	if code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Dear |12345678|,|1.5|90071992547409930", documentText(t, content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderYAMLFromStdin(t *testing.T) {
+	template := writeTemplate(t, t.TempDir())
+	code, stdout, stderr := runCommand("items:\n- article: Towel\n", "render", "-format", "yaml", "-set", "customer.name=Ford", template, "-", "-o", "-")
+	if code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	if expected, actual := "Dear |Ford|,|Towel", documentText(t, []byte(stdout)); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	dir := t.TempDir()
+	template := writeTemplate(t, dir)
+	data := filepath.Join(dir, "customers.csv")
+	ioutil.WriteFile(data, []byte("customer.name,article\nArthur,Towel\nFord,Guide\n"), 0666)
+
+	out := filepath.Join(dir, "letters")
+	if code, _, stderr := runCommand("", "render", template, data, "-dir", out, "-name", "«customer.name».docx", "-missing", "blank"); code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(out, "Ford.docx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Dear |Ford|,", documentText(t, content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	merged := filepath.Join(dir, "merged.docx")
+	if code, _, stderr := runCommand("", "render", template, data, "-merge", "page", "-o", merged, "-missing", "blank"); code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	content, _ = ioutil.ReadFile(merged)
+	if expected, actual := "Dear |Arthur|,|Dear |Ford|,", documentText(t, content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := t.TempDir()
+	template := writeTemplate(t, dir)
+	for _, test := range []struct {
+		args []string
+		code int
+		err  string
+	}{
+		{[]string{"unknown"}, 2, "unknown command"},
+		{[]string{"render", template}, 2, "expected either -o"},
+		{[]string{"render", template, "-o", "-", "-missing", "maybe"}, 2, "unknown mode"},
+		{[]string{"render", template, "-", "-o", "-"}, 2, "-format is needed"},
+		{[]string{"render", template, "-o", "-", "-strict"}, 1, "placeholders without data: customer.name"},
+		{[]string{"render", filepath.Join(dir, "missing.docx"), "-o", "-"}, 1, "no such file"},
+	} {
+		code, _, stderr := runCommand("", test.args...)
+		if code != test.code || !strings.Contains(stderr, test.err) {
+			t.Errorf("%v: expected %d and %q, got %d and %q", test.args, test.code, test.err, code, stderr)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "-")); err == nil {
+		t.Error("expected no file named -")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	template := writeTemplate(t, t.TempDir())
+	code, stdout, stderr := runCommand("", "inspect", template)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !regexp.MustCompile(`word/document.xml +application/xml +\d+ bytes \(\d+ compressed\)`).MatchString(stdout) {
+		t.Errorf("expected the document part in\n%s", stdout)
+	}
+	for _, expected := range []string{
+		"«customer.name»  word/document.xml, paragraph 1",
+		"loop items  word/document.xml, paragraph 2",
+		"    «article»  word/document.xml, paragraph 3",
+		"Warnings:\n  none",
+	} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("expected %q in\n%s", expected, stdout)
+		}
+	}
+
+	code, stdout, stderr = runCommand("", "inspect", "-json", template)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var result struct {
+		Parts     []docx.PackagePart
+		Structure docx.Structure
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Parts) != 2 || len(result.Structure.Loops) != 1 || result.Structure.Loops[0].Placeholders[0].Name != "article" {
+		t.Errorf("unexpected result %s", stdout)
+	}
+}
+
+func TestInspectWarnings(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"word/document.xml": strings.Replace(testDocument, "«end:items»", "«end:item»", 1),
+		"docProps/custom.xml": `<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" ` +
+			`xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` +
+			`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="Pages"><vt:i4>many</vt:i4></property></Properties>`,
+	} {
+		f, _ := w.Create(name)
+		f.Write([]byte(content))
+	}
+	w.Close()
+	template := filepath.Join(dir, "broken.docx")
+	if err := ioutil.WriteFile(template, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCommand("", "inspect", template)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "the template cannot be parsed") || !strings.Contains(stdout, "  word/document.xml: ") {
+		t.Errorf("expected a warning for the unbalanced loop in\n%s", stdout)
+	}
+	if !strings.Contains(stdout, `  docProps/custom.xml: property "Pages"`) || !strings.Contains(stdout, "  word/document.xml  ") {
+		t.Errorf("expected a warning for the property and the parts to be listed in\n%s", stdout)
+	}
+}
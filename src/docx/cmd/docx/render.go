@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"docx"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var renderCommand = &command{
+	name:    "render",
+	args:    "template.docx [data.json|data.yaml|data.csv|-]",
+	summary: "render a template with data from JSON, YAML or CSV",
+	doc: "Render renders a template with data from a JSON, YAML or CSV file, or from stdin.\n" +
+		"A list of records, like the rows of a CSV file, is merged into a docx per record\n" +
+		"(-dir, -zip), a single docx (-merge) or rendered as a loop (-loop).",
+	setup: setupRender,
+}
+
+// renderFlags holds the flags of the render command.
+type renderFlags struct {
+	output    string
+	format    string
+	values    valueFlags
+	loop      string
+	dir       string
+	zip       string
+	name      string
+	merge     string
+	strict    bool
+	missing   string
+	highlight string
+	locale    string
+	parts     string
+}
+
+func setupRender(fs *flag.FlagSet) func(ctx context.Context, env *environment, args []string) error {
+	f := &renderFlags{}
+	fs.StringVar(&f.output, "o", "", "write the docx to `file`, - for stdout")
+	fs.StringVar(&f.format, "format", "", "format of the data: json, yaml or csv (default from the file extension)")
+	fs.Var(&f.values, "set", "set a value given as `name=value`, e.g. customer.name=Arthur; may be repeated")
+	fs.StringVar(&f.loop, "loop", "", "render a list of records as the loop `name`")
+	fs.StringVar(&f.dir, "dir", "", "write a docx per record to `directory`")
+	fs.StringVar(&f.zip, "zip", "", "write a docx per record to the zip archive `file`, - for stdout")
+	fs.StringVar(&f.name, "name", "«#number».docx", "`pattern` of the file names for -dir and -zip, rendered with the record")
+	fs.StringVar(&f.merge, "merge", "", "merge the records into a single docx, separated by a section or page `break`")
+	fs.BoolVar(&f.strict, "strict", false, "fail if a placeholder has no data or some data is not used")
+	fs.StringVar(&f.missing, "missing", "keep", "render placeholders without data: keep, blank or highlight")
+	fs.StringVar(&f.highlight, "highlight", "", "highlight `color` of -missing highlight (default yellow)")
+	fs.StringVar(&f.locale, "locale", "", "locale of the formatters, e.g. de-DE")
+	fs.StringVar(&f.parts, "parts", "", "comma-separated story parts to render, e.g. word/document.xml (default all)")
+	return func(ctx context.Context, env *environment, args []string) error {
+		return f.render(ctx, env, args)
+	}
+}
+
+func (f *renderFlags) render(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a template and an optional data file")
+	}
+	options, err := f.options()
+	if err != nil {
+		return err
+	}
+	modes := 0
+	for _, mode := range []string{f.loop, f.dir, f.zip, f.merge} {
+		if mode != "" {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return usageError("-loop, -dir, -zip and -merge exclude each other")
+	}
+	if (f.dir == "" && f.zip == "") == (f.output == "") {
+		return usageError("expected either -o or one of -dir and -zip")
+	}
+
+	var data interface{} = map[string]interface{}{}
+	if len(args) == 2 {
+		if data, err = readData(args[1], f.format, env.stdin); err != nil {
+			return err
+		}
+	}
+	for _, v := range f.values {
+		if err := v.apply(data); err != nil {
+			return err
+		}
+	}
+
+	r, err := docx.ReadDocxFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	template, err := docx.NewTemplate(r, options)
+	if err != nil {
+		return err
+	}
+
+	records, isList := data.([]interface{})
+	switch {
+	case f.dir != "":
+		if !isList {
+			return usageError("-dir expects a list of records")
+		}
+		if err := os.MkdirAll(f.dir, 0777); err != nil {
+			return err
+		}
+		return template.MergeToDir(ctx, records, f.dir, f.name)
+	case f.zip != "":
+		if !isList {
+			return usageError("-zip expects a list of records")
+		}
+		return writeOutput(f.zip, env, func(w io.Writer) error {
+			return template.MergeToZip(ctx, records, w, f.name)
+		})
+	case f.merge != "":
+		separator, ok := map[string]docx.MergeBreak{"section": docx.SectionBreak, "page": docx.PageBreak}[f.merge]
+		if !ok {
+			return usageError(fmt.Sprintf("unknown break %q, expected section or page", f.merge))
+		}
+		if !isList {
+			return usageError("-merge expects a list of records")
+		}
+		d, err := template.MergeDocument(ctx, records, separator)
+		if err != nil {
+			return err
+		}
+		return writeOutput(f.output, env, func(w io.Writer) error { return d.Write(w) })
+	case f.loop != "":
+		if !isList {
+			return usageError("-loop expects a list of records")
+		}
+		data = map[string]interface{}{f.loop: records}
+	case isList:
+		return usageError("the data is a list of records, use -loop, -dir, -zip or -merge")
+	}
+	d, err := template.Render(ctx, data)
+	if err != nil {
+		return err
+	}
+	return writeOutput(f.output, env, func(w io.Writer) error { return d.Write(w) })
+}
+
+// options returns the render options given by the flags.
+func (f *renderFlags) options() (docx.RenderOptions, error) {
+	options := docx.RenderOptions{Strict: f.strict, HighlightColor: f.highlight, Locale: f.locale}
+	switch f.missing {
+	case "keep":
+		options.Missing = docx.KeepMissing
+	case "blank":
+		options.Missing = docx.BlankMissing
+	case "highlight":
+		options.Missing = docx.HighlightMissing
+	default:
+		return options, usageError(fmt.Sprintf("unknown mode %q for -missing, expected keep, blank or highlight", f.missing))
+	}
+	if f.parts != "" {
+		options.Parts = strings.Split(f.parts, ",")
+	}
+	return options, nil
+}
+
+// writeOutput writes to the file name, or to stdout for "-". A file is
+// removed again if writing fails.
+func writeOutput(name string, env *environment, write func(w io.Writer) error) error {
+	if name == "-" {
+		return write(env.stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
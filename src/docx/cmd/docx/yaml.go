@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that is used for data files: block
+// mappings and sequences, flow collections on a single line, plain and
+// quoted scalars, literal (|) and folded (>) block scalars and comments.
+// Anchors, tags and multiple documents are not supported.
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		line := yamlLine{number: i + 1, indent: len(raw) - len(text), text: stripComment(text), raw: raw}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", line.number)
+		}
+		if line.text == "---" || strings.HasPrefix(line.text, "%") {
+			continue
+		}
+		p.lines = append(p.lines, line)
+	}
+	p.skipEmpty()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipEmpty(); p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string // text without indentation and comment
+	raw    string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	number := len(p.lines)
+	if p.pos < len(p.lines) {
+		number = p.lines[p.pos].number
+	}
+	return fmt.Errorf("line %d: %s", number, fmt.Sprintf(format, args...))
+}
+
+// skipEmpty skips empty lines and comments.
+func (p *yamlParser) skipEmpty() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+// next returns the next line that is not empty, if it is indented by at least indent.
+func (p *yamlParser) next(indent int) (yamlLine, bool) {
+	p.skipEmpty()
+	if p.pos == len(p.lines) || p.lines[p.pos].indent < indent {
+		return yamlLine{}, false
+	}
+	return p.lines[p.pos], true
+}
+
+// block parses the mapping, sequence or scalar starting at the current line.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	line, _ := p.next(indent)
+	if isSequenceItem(line.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitKey(line.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return parseScalar(line.text)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for {
+		line, ok := p.next(indent)
+		if !ok || line.indent != indent || !isSequenceItem(line.text) {
+			return items, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		var item interface{}
+		var err error
+		if rest == "" {
+			p.pos++
+			if next, ok := p.next(indent + 1); ok {
+				item, err = p.block(next.indent)
+			}
+		} else {
+			// the item continues at the column of its text, e.g. "- name: x"
+			p.lines[p.pos].indent += len(line.text) - len(rest)
+			p.lines[p.pos].text = rest
+			item, err = p.block(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		line, ok := p.next(indent)
+		if !ok {
+			return m, nil
+		}
+		if line.indent != indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := splitKey(line.text)
+		if !ok {
+			if isSequenceItem(line.text) {
+				return m, nil
+			}
+			return nil, p.errorf("expected a key")
+		}
+		if _, exists := m[key]; exists {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		var v interface{}
+		var err error
+		switch {
+		case rest == "":
+			p.pos++
+			if next, ok := p.next(indent); ok && (next.indent > indent || isSequenceItem(next.text)) {
+				v, err = p.block(next.indent)
+			}
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			p.pos++
+			v, err = p.blockScalar(rest, indent)
+		default:
+			p.pos++
+			v, err = parseScalar(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// blockScalar parses the lines of a literal (|) or folded (>) block scalar.
+func (p *yamlParser) blockScalar(header string, indent int) (string, error) {
+	chomp := strings.TrimLeft(header[1:], " ")
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line.raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent || (blockIndent >= 0 && line.indent < blockIndent) {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, line.raw[blockIndent:])
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var text string
+	if header[0] == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || lines[i-1] == "":
+				text += "\n"
+			default:
+				text += " "
+			}
+			text += line
+		}
+	}
+	switch chomp {
+	case "":
+		text += "\n"
+	case "+":
+		text += strings.Repeat("\n", trailing+1)
+	}
+	if len(lines) == 0 && chomp != "+" {
+		return "", nil
+	}
+	return text, nil
+}
+
+// stripComment removes a comment from a line, which starts with "#" at the
+// start of the line or after a space outside of quotes.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return strings.TrimRight(text, " ")
+}
+
+// splitKey splits a line like "name: value" into key and value.
+func splitKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := quotedEnd(text)
+		if end < 0 || !strings.HasPrefix(text[end:], ":") {
+			return "", "", false
+		}
+		key, err := parseQuoted(text[:end])
+		if err != nil {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[end+1:]), true
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), i > 0
+		}
+	}
+	return "", "", false
+}
+
+// quotedEnd returns the index after the closing quote of a quoted scalar, or -1.
+func quotedEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quote == '"':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func parseQuoted(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(text)
+}
+
+// parseScalar parses a value on a single line.
+func parseScalar(text string) (interface{}, error) {
+	f := &flowParser{text: text}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.text) {
+		return nil, fmt.Errorf("unexpected %q", f.text[f.pos:])
+	}
+	return v, nil
+}
+
+// flowParser parses flow collections like [a, b] and {name: a} and scalars.
+type flowParser struct {
+	text string
+	pos  int
+}
+
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *flowParser) value() (interface{}, error) {
+	f.skipSpace()
+	if f.pos == len(f.text) {
+		return nil, nil
+	}
+	switch f.text[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		end := quotedEnd(f.text[f.pos:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", f.text[f.pos:])
+		}
+		s, err := parseQuoted(f.text[f.pos : f.pos+end])
+		f.pos += end
+		return s, err
+	}
+	return plainScalar(f.plain()), nil
+}
+
+// plain returns a plain scalar, which ends at "," "]" "}" or ": " within flow collections.
+func (f *flowParser) plain() string {
+	start := f.pos
+	nested := strings.ContainsAny(f.text[:start], "[{")
+	for ; f.pos < len(f.text); f.pos++ {
+		c := f.text[f.pos]
+		if nested && (c == ',' || c == ']' || c == '}' || c == ':' && (f.pos+1 == len(f.text) || f.text[f.pos+1] == ' ')) {
+			break
+		}
+	}
+	return strings.TrimSpace(f.text[start:f.pos])
+}
+
+func (f *flowParser) expect(c byte) error {
+	f.skipSpace()
+	if f.pos == len(f.text) || f.text[f.pos] != c {
+		return fmt.Errorf("expected %q in %s", c, f.text)
+	}
+	f.pos++
+	return nil
+}
+
+// more reports whether another item follows in a collection that ends with end.
+func (f *flowParser) more(end byte) (bool, error) {
+	f.skipSpace()
+	if f.pos < len(f.text) && f.text[f.pos] == end {
+		f.pos++
+		return false, nil
+	}
+	return true, f.expect(',')
+}
+
+func (f *flowParser) sequence() ([]interface{}, error) {
+	f.pos++
+	items := []interface{}{}
+	if f.skipSpace(); f.pos < len(f.text) && f.text[f.pos] == ']' {
+		f.pos++
+		return items, nil
+	}
+	for {
+		item, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if more, err := f.more(']'); !more || err != nil {
+			return items, err
+		}
+	}
+}
+
+func (f *flowParser) mapping() (map[string]interface{}, error) {
+	f.pos++
+	m := make(map[string]interface{})
+	if f.skipSpace(); f.pos < len(f.text) && f.text[f.pos] == '}' {
+		f.pos++
+		return m, nil
+	}
+	for {
+		key, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := f.expect(':'); err != nil {
+			return nil, err
+		}
+		if m[fmt.Sprint(key)], err = f.value(); err != nil {
+			return nil, err
+		}
+		if more, err := f.more('}'); !more || err != nil {
+			return m, err
+		}
+	}
+}
+
+// plainScalar returns the value of an unquoted scalar: null, a bool, a number or a string.
+func plainScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		return f
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	data := `# customer data
+---
+title: "Invoice #42" # the title
+customer:
+  name: Arthur Dent
+  address: {street: 155 Country Lane, city: 'Cottington'}
+vip: true
+discount: 0.5
+items:
+- article: Towel
+  qty: 1
+- article: Guide
+  qty: 42
+  tags: [travel, "book"]
+notes: |
+  Don't panic.
+  Bring a towel.
+summary: >-
+  Mostly
+  harmless.
+empty:
+`
+	expected := map[string]interface{}{
+		"title": "Invoice #42",
+		"customer": map[string]interface{}{
+			"name":    "Arthur Dent",
+			"address": map[string]interface{}{"street": "155 Country Lane", "city": "Cottington"},
+		},
+		"vip":      true,
+		"discount": 0.5,
+		"items": []interface{}{
+			map[string]interface{}{"article": "Towel", "qty": int64(1)},
+			map[string]interface{}{"article": "Guide", "qty": int64(42), "tags": []interface{}{"travel", "book"}},
+		},
+		"notes":   "Don't panic.\nBring a towel.\n",
+		"summary": "Mostly harmless.",
+		"empty":   nil,
+	}
+	v, err := parseYAML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %#v, got %#v", expected, v)
+	}
+}
+
+func TestParseYAMLList(t *testing.T) {
+	v, err := parseYAML([]byte("- name: Arthur\n-\n  name: Ford\n- [1, 2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "Arthur"},
+		map[string]interface{}{"name": "Ford"},
+		[]interface{}{int64(1), int64(2)},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %#v, got %#v", expected, v)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, data := range []string{
+		"name: a\n  city: b\n",
+		"name: a\nname: b\n",
+		"name: [a, b\n",
+		"name: \"a\n",
+	} {
+		if _, err := parseYAML([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
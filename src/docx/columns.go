@@ -0,0 +1,348 @@
+package docx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"xml"
+)
+
+// columnMarker is a «startcol:name» or «endcol:name» marker within a table row.
+type columnMarker struct {
+	field       *field
+	parent      *element // element holding the field
+	first, last int      // grid columns of the cell holding the marker
+	isStart     bool
+	name        string
+}
+
+// columnRegion is a pair of column markers.
+type columnRegion struct {
+	start, end  *columnMarker
+	first, last int // grid columns spanned by the region
+}
+
+// expandColumnLoops turns the «startcol:name» ... «endcol:name» regions of
+// all tables into loops that repeat table columns. Both markers have to be
+// in the same row. Every row of the table gets a loop over its cells within
+// the grid columns of the marker cells, and the grid gets a loop over the
+// corresponding <w:gridCol> elements, so each data element adds columns.
+// A table width in twips is set to the width of the rendered grid (see
+// fitTableWidth), widths in percent or auto are kept.
+// Tables nested in cells are expanded first.
+func expandColumnLoops(nodes []xml.Token) error {
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			continue
+		}
+		if err := expandColumnLoops(el.children); err != nil {
+			return err
+		}
+		if el.is("tbl") {
+			if err := expandTableColumns(el); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandTableColumns expands the column loops of a single table. The same
+// column loop may be marked in several rows, e.g. the header and the body
+// row; its columns are repeated once.
+func expandTableColumns(table *element) error {
+	var regions []columnRegion
+	for _, row := range table.children {
+		if el, ok := row.(*element); ok && el.is("tr") {
+			rowRegions, err := pairColumnMarkers(findColumnMarkers(el))
+			if err != nil {
+				return err
+			}
+			regions = append(regions, rowRegions...)
+		}
+	}
+	unique, err := uniqueColumnRegions(regions)
+	if err != nil {
+		return err
+	}
+	for _, region := range unique {
+		if err := wrapColumns(table, region); err != nil {
+			return err
+		}
+	}
+	for _, region := range regions {
+		for _, m := range []*columnMarker{region.start, region.end} {
+			var children []xml.Token
+			for _, c := range m.parent.children {
+				if c != xml.Token(m.field) {
+					children = append(children, c)
+				}
+			}
+			m.parent.children = children
+		}
+	}
+	return nil
+}
+
+// uniqueColumnRegions returns the regions that span different columns,
+// innermost first. Regions have to be nested or apart from each other.
+func uniqueColumnRegions(regions []columnRegion) ([]columnRegion, error) {
+	var unique []columnRegion
+	for _, r := range regions {
+		duplicate := false
+		for _, u := range unique {
+			inside := u.first <= r.first && r.last <= u.last
+			outside := r.first <= u.first && u.last <= r.last
+			switch {
+			case u.start.name == r.start.name && u.first == r.first && u.last == r.last:
+				duplicate = true
+			case u.start.name == r.start.name:
+				return nil, fmt.Errorf("column loop %q spans different columns in different rows", r.start.name)
+			case r.first <= u.last && u.first <= r.last && !inside && !outside:
+				return nil, fmt.Errorf("column loops %q and %q overlap", u.start.name, r.start.name)
+			}
+		}
+		if !duplicate {
+			unique = append(unique, r)
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return unique[i].last-unique[i].first < unique[j].last-unique[j].first
+	})
+	return unique, nil
+}
+
+// findColumnMarkers returns the column markers of a row in document order.
+func findColumnMarkers(row *element) []*columnMarker {
+	var markers []*columnMarker
+	var find func(parent *element, first, last int)
+	find = func(parent *element, first, last int) {
+		for _, c := range parent.children {
+			switch node := c.(type) {
+			case *field:
+				m := &columnMarker{field: node, parent: parent, first: first, last: last}
+				switch {
+				case strings.HasPrefix(node.name, columnStartPrefix):
+					m.isStart, m.name = true, strings.TrimPrefix(node.name, columnStartPrefix)
+				case strings.HasPrefix(node.name, columnEndPrefix):
+					m.name = strings.TrimPrefix(node.name, columnEndPrefix)
+				default:
+					continue
+				}
+				markers = append(markers, m)
+			case *element:
+				if !node.is("tbl") {
+					find(node, first, last)
+				}
+			}
+		}
+	}
+	column := gridBefore(row)
+	for _, c := range row.children {
+		for _, cell := range rowCells(c) {
+			span := gridSpan(cell)
+			find(cell, column, column+span-1)
+			column += span
+		}
+	}
+	return markers
+}
+
+// pairColumnMarkers matches the start and end markers of a row.
+// The regions are returned innermost first.
+func pairColumnMarkers(markers []*columnMarker) ([]columnRegion, error) {
+	var regions []columnRegion
+	var stack []*columnMarker
+	for _, m := range markers {
+		if m.isStart {
+			stack = append(stack, m)
+			continue
+		}
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("column loop %q ends without being started", m.name)
+		}
+		start := stack[len(stack)-1]
+		if start.name != m.name {
+			return nil, fmt.Errorf("column loop %q ends before the inner column loop %q", m.name, start.name)
+		}
+		stack = stack[:len(stack)-1]
+		regions = append(regions, columnRegion{start: start, end: m, first: start.first, last: m.last})
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("column loop %q does not end in the same table row", stack[len(stack)-1].name)
+	}
+	return regions, nil
+}
+
+// wrapColumns replaces the cells and grid columns of a region by loops.
+func wrapColumns(table *element, region columnRegion) error {
+	for _, c := range table.children {
+		el, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		var err error
+		switch {
+		case el.is("tblGrid"):
+			el.children, err = wrapRegion(el.children, 0, region, gridColumns)
+		case el.is("tr"):
+			el.children, err = wrapRegion(el.children, gridBefore(el), region, func(node xml.Token) int {
+				span := 0
+				for _, cell := range rowCells(node) {
+					span += gridSpan(cell)
+				}
+				return span
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapRegion replaces the nodes within the grid columns of a region by a loop.
+// width returns the number of grid columns of a node, column is the grid column of the first node.
+func wrapRegion(nodes []xml.Token, column int, region columnRegion, width func(xml.Token) int) ([]xml.Token, error) {
+	name := region.start.name
+	var result, body []xml.Token
+	wrap := func() {
+		if len(body) > 0 {
+			result = append(result, &loop{name: name, start: region.start.field, end: region.end.field, body: body, source: copyTree(body)})
+			body = nil
+		}
+	}
+	for _, n := range nodes {
+		span := width(n)
+		if span == 0 {
+			result = append(result, n)
+			continue
+		}
+		first, last := column, column+span-1
+		column += span
+		switch {
+		case first >= region.first && last <= region.last:
+			body = append(body, n)
+			if last == region.last {
+				wrap()
+			}
+		case last < region.first || first > region.last:
+			result = append(result, n)
+		default:
+			return nil, fmt.Errorf("column loop %q splits a merged cell", name)
+		}
+	}
+	wrap()
+	return result, nil
+}
+
+// gridColumns returns the number of grid columns of a child of <w:tblGrid>.
+func gridColumns(node xml.Token) int {
+	switch n := node.(type) {
+	case *element:
+		if n.is("gridCol") {
+			return 1
+		}
+	case *loop:
+		columns := 0
+		for _, c := range n.body {
+			columns += gridColumns(c)
+		}
+		return columns
+	}
+	return 0
+}
+
+// hasColumnLoops reports whether a parsed table repeats columns.
+func hasColumnLoops(table *element) bool {
+	grid := table.child("tblGrid")
+	if !table.is("tbl") || grid == nil {
+		return false
+	}
+	for _, c := range grid.children {
+		if _, ok := c.(*loop); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fitTableWidth sets the fixed width of a rendered table to the sum of its
+// grid columns, which column loops have added or removed.
+func fitTableWidth(table *element) {
+	props, grid := table.child("tblPr"), table.child("tblGrid")
+	if props == nil || grid == nil {
+		return
+	}
+	width := props.child("tblW")
+	if width == nil || attrValue(width.StartElement, "type") != "dxa" {
+		return
+	}
+	total := 0
+	for _, c := range grid.children {
+		if col, ok := c.(*element); ok && col.is("gridCol") {
+			w, err := strconv.Atoi(attrValue(col.StartElement, "w"))
+			if err != nil {
+				return
+			}
+			total += w
+		}
+	}
+	for i, a := range width.Attr {
+		if a.Name.Space == wordNamespace && a.Name.Local == "w" {
+			width.Attr[i].Value = strconv.Itoa(total)
+		}
+	}
+}
+
+// rowCells returns the cells of a row child: the cell itself or
+// the cells of a column loop.
+func rowCells(node xml.Token) []*element {
+	switch n := node.(type) {
+	case *element:
+		if n.is("tc") {
+			return []*element{n}
+		}
+	case *loop:
+		var cells []*element
+		for _, c := range n.body {
+			cells = append(cells, rowCells(c)...)
+		}
+		return cells
+	}
+	return nil
+}
+
+// gridSpan returns the number of grid columns spanned by a cell.
+func gridSpan(cell *element) int {
+	if props := cell.child("tcPr"); props != nil {
+		if span := intValue(props.child("gridSpan")); span > 0 {
+			return span
+		}
+	}
+	return 1
+}
+
+// gridBefore returns the number of grid columns skipped before the first cell of a row.
+func gridBefore(row *element) int {
+	if props := row.child("trPr"); props != nil {
+		return intValue(props.child("gridBefore"))
+	}
+	return 0
+}
+
+// intValue returns the w:val attribute of an element as a number.
+func intValue(e *element) int {
+	if e == nil {
+		return 0
+	}
+	for _, a := range e.Attr {
+		if a.Name.Space == wordNamespace && a.Name.Local == "val" {
+			n, _ := strconv.Atoi(a.Value)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package docx_test
+
+import (
+	"strings"
+	"testing"
+)
+
+const testColumnTable = `<w:tbl><w:tblGrid><w:gridCol w:w="2000"/><w:gridCol w:w="1000"/><w:gridCol w:w="1500"/></w:tblGrid>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc>` +
+	`<w:tc><w:p><w:r><w:t>«startcol:period»</w:t></w:r><w:r><w:t>«label»</w:t></w:r><w:r><w:t>«endcol:period»</w:t></w:r></w:p></w:tc>` +
+	`<w:tc><w:p><w:r><w:t>Total</w:t></w:r></w:p></w:tc></w:tr>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>«name»</w:t></w:r></w:p></w:tc>` +
+	`<w:tc><w:p><w:r><w:t>«hours»</w:t></w:r></w:p></w:tc>` +
+	`<w:tc><w:p><w:r><w:t>«total»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`
+
+func TestColumnLoop(t *testing.T) {
+	d := newTestDocx(t, testColumnTable)
+	data := map[string]interface{}{
+		"name":  "Arthur",
+		"total": 12,
+		"period": []map[string]interface{}{
+			{"label": "Q1", "hours": 5},
+			{"label": "Q2", "hours": 7},
+		},
+	}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Name|Q1|Q2|Total|Arthur|5|7|12", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	expected := `<w:tblGrid><w:gridCol w:w="2000"></w:gridCol><w:gridCol w:w="1000"></w:gridCol><w:gridCol w:w="1000"></w:gridCol><w:gridCol w:w="1500"></w:gridCol></w:tblGrid>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+}
+
+func TestColumnLoopTableWidth(t *testing.T) {
+	d := newTestDocx(t, strings.Replace(testColumnTable, `<w:tbl>`, `<w:tbl><w:tblPr><w:tblW w:w="4500" w:type="dxa"/></w:tblPr>`, 1))
+	period := []map[string]string{{"label": "Q1"}, {"label": "Q2"}, {"label": "Q3"}}
+	if err := d.ReplaceLoop("period", period); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, `<w:tblW w:w="6500" w:type="dxa">`) {
+		t.Errorf("expected the table to be widened, got %s", d.Content)
+	}
+}
+
+func TestColumnLoopMarkedInSeveralRows(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tblGrid><w:gridCol w:w="2000"/><w:gridCol w:w="1000"/></w:tblGrid>`+
+		`<w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«startcol:period»«label»«endcol:period»</w:t></w:r></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:p><w:r><w:t>«name»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«startcol:period»«hours»«endcol:period»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	data := map[string]interface{}{
+		"name":   "Arthur",
+		"period": []map[string]interface{}{{"label": "Q1", "hours": 5}, {"label": "Q2", "hours": 7}},
+	}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Name|Q1|Q2|Arthur|5|7", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if count := strings.Count(d.Content, "<w:tc>"); count != 6 {
+		t.Errorf("expected 3 cells per row, got %d in %s", count, d.Content)
+	}
+	if count := strings.Count(d.Content, "<w:gridCol "); count != 3 {
+		t.Errorf("expected 3 grid columns, got %d in %s", count, d.Content)
+	}
+}
+
+func TestColumnLoopsOverlap(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«startcol:a»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«endcol:a»</w:t></w:r></w:p></w:tc><w:tc><w:p></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:p></w:p></w:tc><w:tc><w:p><w:r><w:t>«startcol:b»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«endcol:b»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	if err := d.Render(map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("expected an error for overlapping column loops, got %v", err)
+	}
+}
+
+func TestColumnLoopWithoutElements(t *testing.T) {
+	d := newTestDocx(t, testColumnTable)
+	if err := d.ReplaceLoop("period", nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Name|Total|«name»|«total»", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if count := strings.Count(d.Content, "<w:gridCol "); count != 2 {
+		t.Errorf("expected 2 grid columns, got %d in %s", count, d.Content)
+	}
+}
+
+func TestColumnLoopSplitsMergedCell(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«startcol:x»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«endcol:x»</w:t></w:r></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:tcPr><w:gridSpan w:val="3"/></w:tcPr><w:p></w:p></w:tc></w:tr></w:tbl>`)
+	if err := d.ReplaceLoop("x", nil); err == nil {
+		t.Error("expected an error for a merged cell across the column loop")
+	}
+}
+
+func TestInspectColumnLoop(t *testing.T) {
+	s, err := newTestDocx(t, testColumnTable).Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Loops) != 1 || s.Loops[0].Name != "period" {
+		t.Fatalf("expected a single loop, got %+v", s.Loops)
+	}
+	if placeholders := s.Loops[0].Placeholders; len(placeholders) != 2 || placeholders[0].Name != "label" || placeholders[1].Name != "hours" {
+		t.Errorf("unexpected loop placeholders %+v", placeholders)
+	}
+}
@@ -0,0 +1,437 @@
+package docx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"xml"
+)
+
+const (
+	w14Namespace = "http://schemas.microsoft.com/office/word/2010/wordml"
+	w15Namespace = "http://schemas.microsoft.com/office/word/2012/wordml"
+)
+
+const placeholderStyle = "PlaceholderText"
+
+// ContentControlOptions determine how content controls are filled.
+type ContentControlOptions struct {
+	// RemoveControls replaces the filled content controls by their content,
+	// so the document keeps the values but not the controls.
+	RemoveControls bool
+}
+
+// SetContentControl sets the content of the content controls whose tag or
+// alias is name. See FillContentControls for the supported values.
+func (d *Docx) SetContentControl(name string, value interface{}) error {
+	filled, err := d.fillContentControls(map[string]interface{}{name: value}, ContentControlOptions{})
+	if err == nil && filled == 0 {
+		err = fmt.Errorf("content control %q not found", name)
+	}
+	return err
+}
+
+// FillContentControls sets the content of the content controls (<w:sdt>)
+// of all story parts. The value of a control is looked up in data by the
+// tag of the control, or by its alias (the title shown in Word), like the
+// placeholders of Render. Controls without a value are left as they are.
+//
+// The content takes the format of the first run of the control:
+//   - plain and rich text controls show the text of the value, line breaks
+//     start a new paragraph in block-level controls
+//   - date controls take a time.Time or a string like "2006-01-02" and show
+//     it in the date format and language of the control
+//   - check boxes are checked if the value is true, like the conditions of Render
+//   - drop-down lists select the item whose value or display text is the
+//     text of the value; combo boxes also accept other text
+//   - repeating sections take a slice and repeat their first item for each
+//     element, filling the controls within the item with the element's data
+func (d *Docx) FillContentControls(data interface{}, options ContentControlOptions) error {
+	_, err := d.fillContentControls(data, options)
+	return err
+}
+
+// fillContentControls fills the controls of all parts and returns the number of filled controls.
+func (d *Docx) fillContentControls(data interface{}, options ContentControlOptions) (int, error) {
+	filler := &controlFiller{options: options}
+	contents := make(map[string]string)
+	for _, name := range d.PartNames() {
+		tokens, err := readTokens(d.part(name))
+		if err != nil {
+			return 0, err
+		}
+		filled := filler.filled
+		tree, err := filler.fill(buildTree(stripIgnorable(tokens)), &scope{data: data})
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", name, err)
+		}
+		if filler.filled == filled {
+			continue
+		}
+		if contents[name], err = encodeString(tree); err != nil {
+			return 0, err
+		}
+	}
+	for name, content := range contents {
+		d.setPart(name, content)
+	}
+	return filler.filled, nil
+}
+
+// controlFiller fills the content controls of a part.
+type controlFiller struct {
+	options ContentControlOptions
+	filled  int
+}
+
+// fill fills the controls within nodes with the data of s.
+func (c *controlFiller) fill(nodes []xml.Token, s *scope) ([]xml.Token, error) {
+	var result []xml.Token
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			result = append(result, n)
+			continue
+		}
+		if !el.is("sdt") {
+			children, err := c.fill(el.children, s)
+			if err != nil {
+				return nil, err
+			}
+			el.children = children
+			result = append(result, el)
+			continue
+		}
+		filled, err := c.fillControl(el, s)
+		if err != nil {
+			return nil, err
+		}
+		if filled && c.options.RemoveControls {
+			result = append(result, controlContent(el)...)
+			continue
+		}
+		result = append(result, el)
+	}
+	return result, nil
+}
+
+// fillControl fills a single control. Controls without a value are searched for nested controls.
+func (c *controlFiller) fillControl(sdt *element, s *scope) (bool, error) {
+	props, content := sdt.child("sdtPr"), sdt.child("sdtContent")
+	if props == nil || content == nil {
+		return false, nil
+	}
+	name, value, ok := controlValue(props, s)
+	if !ok {
+		children, err := c.fill(content.children, s)
+		content.children = children
+		return false, err
+	}
+	c.filled++
+	removePlaceholder(props)
+
+	var err error
+	if findElement(props, w15Namespace, "repeatingSection") != nil {
+		err = c.fillRepeatingSection(name, content, value, s)
+	} else {
+		err = fillValue(props, content, value)
+	}
+	if err != nil {
+		return false, fmt.Errorf("content control %q: %v", name, err)
+	}
+	return true, nil
+}
+
+// fillValue sets the content of a control that is not a repeating section.
+func fillValue(props, content *element, value interface{}) error {
+	switch {
+	case findElement(props, w14Namespace, "checkbox") != nil:
+		fillCheckbox(props, content, isTrue(value))
+	case props.child("date") != nil:
+		return fillDate(props, content, value)
+	case props.child("dropDownList") != nil:
+		return fillList(props, props.child("dropDownList"), content, valueText(value), true)
+	case props.child("comboBox") != nil:
+		return fillList(props, props.child("comboBox"), content, valueText(value), false)
+	default:
+		fillText(props, content, valueText(value))
+	}
+	return nil
+}
+
+// controlValue looks up the value of a control by its tag or alias.
+func controlValue(props *element, s *scope) (string, interface{}, bool) {
+	for _, local := range []string{"tag", "alias"} {
+		if el := props.child(local); el != nil {
+			name := attrValue(el.StartElement, "val")
+			if name == "" {
+				continue
+			}
+			if v, _, ok := s.lookup(name); ok {
+				return name, v, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// controlContent returns the content of a control without the control.
+func controlContent(sdt *element) []xml.Token {
+	if content := sdt.child("sdtContent"); content != nil {
+		return content.children
+	}
+	return nil
+}
+
+// removePlaceholder makes a control show its content instead of the placeholder text.
+func removePlaceholder(props *element) {
+	var children []xml.Token
+	for _, c := range props.children {
+		if el, ok := c.(*element); !ok || !el.is("showingPlcHdr") {
+			children = append(children, c)
+		}
+	}
+	props.children = children
+}
+
+// fillText replaces the content of a control by text. Each line of the text
+// is a paragraph in block-level controls and is separated by a line break
+// otherwise. The text takes the format of the first run and paragraph.
+// The paragraphs of block-level controls are replaced, nested tables and
+// controls are kept.
+func fillText(props, content *element, text string) {
+	run := templateRun(props, content)
+	lines := strings.Split(text, "\n")
+	parent := paragraphParent(content)
+	if parent == nil {
+		content.children = []xml.Token{textRun(run, lines)}
+		return
+	}
+
+	var children []xml.Token
+	added := false
+	for _, c := range parent.children {
+		el, ok := c.(*element)
+		if !ok || !el.is("p") {
+			children = append(children, c)
+			continue
+		}
+		if added {
+			continue
+		}
+		for _, line := range lines {
+			p := &element{StartElement: el.StartElement.Copy()}
+			if props := el.child("pPr"); props != nil {
+				p.children = append(p.children, props.copy())
+			}
+			p.children = append(p.children, textRun(run, []string{line}))
+			children = append(children, p)
+		}
+		added = true
+	}
+	parent.children = children
+}
+
+// paragraphParent returns the element holding the first paragraph of a
+// control, or nil for inline controls. Paragraphs of e itself come before
+// those nested in tables or controls.
+func paragraphParent(e *element) *element {
+	if e.child("p") != nil {
+		return e
+	}
+	for _, c := range e.children {
+		el, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		if el.is("r") {
+			return nil
+		}
+		if parent := paragraphParent(el); parent != nil {
+			return parent
+		}
+	}
+	return nil
+}
+
+// templateRun returns an empty run with the properties of the first run of a
+// control, or with the run properties of the control if it has no run.
+func templateRun(props, content *element) *element {
+	run := newWordElement("r")
+	var runProps *element
+	if first := findElement(content, wordNamespace, "r"); first != nil {
+		runProps = first.child("rPr")
+	} else {
+		runProps = props.child("rPr")
+	}
+	if runProps != nil {
+		runProps = runProps.copy()
+		var children []xml.Token
+		for _, c := range runProps.children {
+			if el, ok := c.(*element); !ok || !el.is("rStyle") || attrValue(el.StartElement, "val") != placeholderStyle {
+				children = append(children, c)
+			}
+		}
+		runProps.children = children
+		run.children = append(run.children, runProps)
+	}
+	return run
+}
+
+// textRun returns a copy of run holding lines separated by line breaks.
+func textRun(run *element, lines []string) *element {
+	result := run.copy()
+	for i, line := range lines {
+		if i > 0 {
+			result.children = append(result.children, newWordElement("br"))
+		}
+		result.children = append(result.children, newTextElement(line))
+	}
+	return result
+}
+
+// fillCheckbox checks or unchecks a check box and shows the symbol of its state.
+func fillCheckbox(props, content *element, checked bool) {
+	box := findElement(props, w14Namespace, "checkbox")
+	state, symbol, val := "uncheckedState", '☐', "0"
+	if checked {
+		state, symbol, val = "checkedState", '☒', "1"
+	}
+	if el := findElement(box, w14Namespace, state); el != nil {
+		if code, err := strconv.ParseInt(w14Value(el), 16, 32); err == nil {
+			symbol = rune(code)
+		}
+	}
+	checkedElement := findElement(box, w14Namespace, "checked")
+	if checkedElement == nil {
+		checkedElement = newElement(w14Namespace, "checked")
+		box.children = append([]xml.Token{checkedElement}, box.children...)
+	}
+	checkedElement.Attr = []xml.Attr{{Name: xml.Name{Space: w14Namespace, Local: "val"}, Value: val}}
+	fillText(props, content, string(symbol))
+}
+
+// w14Value returns the w14:val attribute of an element.
+func w14Value(e *element) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == w14Namespace && a.Name.Local == "val" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// fillDate sets the date of a date picker and shows it in its format and language.
+func fillDate(props, content *element, value interface{}) error {
+	date := props.child("date")
+	t, ok, err := timeValue(value)
+	if err != nil {
+		return err
+	}
+	var attrs []xml.Attr
+	for _, a := range date.Attr {
+		if a.Name.Local != "fullDate" {
+			attrs = append(attrs, a)
+		}
+	}
+	if !ok {
+		date.Attr = attrs
+		fillText(props, content, "")
+		return nil
+	}
+	date.Attr = append(attrs, xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "fullDate"}, Value: t.UTC().Format("2006-01-02T15:04:05") + "Z"})
+
+	locale := defaultLocale
+	if lid := date.child("lid"); lid != nil {
+		if l, err := lookupLocale(attrValue(lid.StartElement, "val")); err == nil {
+			locale = l
+		}
+	}
+	layout := locale.DateLayout
+	if format := date.child("dateFormat"); format != nil && attrValue(format.StartElement, "val") != "" {
+		layout = wordDateLayout(attrValue(format.StartElement, "val"))
+	}
+	text, err := locale.formatDate(t, layout)
+	if err != nil {
+		return err
+	}
+	fillText(props, content, text.(string))
+	return nil
+}
+
+// fillList selects the item of a drop-down list or combo box whose value or
+// display text is text. Only combo boxes accept text that is not an item.
+func fillList(props, list, content *element, text string, strict bool) error {
+	for _, c := range list.children {
+		item, ok := c.(*element)
+		if !ok || !item.is("listItem") {
+			continue
+		}
+		value, display := attrValue(item.StartElement, "value"), attrValue(item.StartElement, "displayText")
+		if text != value && text != display {
+			continue
+		}
+		if display == "" {
+			display = value
+		}
+		var attrs []xml.Attr
+		for _, a := range list.Attr {
+			if a.Name.Local != "lastValue" {
+				attrs = append(attrs, a)
+			}
+		}
+		list.Attr = append(attrs, xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "lastValue"}, Value: value})
+		fillText(props, content, display)
+		return nil
+	}
+	if strict && text != "" {
+		return fmt.Errorf("no item %q", text)
+	}
+	fillText(props, content, text)
+	return nil
+}
+
+// fillRepeatingSection repeats the first item of a repeating section for each
+// element of value and fills the controls of the items with the elements.
+func (c *controlFiller) fillRepeatingSection(name string, content *element, value interface{}, s *scope) error {
+	items, ok := collection(value)
+	if !ok {
+		return fmt.Errorf("expected a list, got %T", value)
+	}
+	var template *element
+	var children []xml.Token
+	for _, n := range content.children {
+		if el, ok := n.(*element); ok && el.is("sdt") && el.child("sdtPr") != nil &&
+			findElement(el.child("sdtPr"), w15Namespace, "repeatingSectionItem") != nil {
+			if template != nil {
+				continue
+			}
+			template = el
+			for i, item := range items {
+				sdt := template.copy()
+				itemContent := sdt.child("sdtContent")
+				if itemContent == nil {
+					continue
+				}
+				inner := &scope{data: item, path: joinPath(s.path, name), parent: s, loop: &loopPosition{index: i, count: len(items), last: i == len(items)-1}}
+				filled, err := c.fill(itemContent.children, inner)
+				if err != nil {
+					return err
+				}
+				itemContent.children = filled
+				if c.options.RemoveControls {
+					children = append(children, filled...)
+				} else {
+					children = append(children, sdt)
+				}
+			}
+			continue
+		}
+		children = append(children, n)
+	}
+	if template == nil {
+		return fmt.Errorf("repeating section has no item")
+	}
+	content.children = children
+	return nil
+}
@@ -0,0 +1,106 @@
+package docx_test
+
+import (
+	"docx"
+	"strings"
+	"testing"
+	"time"
+)
+
+const controlNamespaces = ` xmlns:w14="http://schemas.microsoft.com/office/word/2010/wordml"` +
+	` xmlns:w15="http://schemas.microsoft.com/office/word/2012/wordml"`
+
+// inlineControl returns an inline content control with the given tag, properties and content.
+func inlineControl(tag, props, content string) string {
+	return `<w:sdt` + controlNamespaces + `><w:sdtPr><w:tag w:val="` + tag + `"/>` + props + `</w:sdtPr>` +
+		`<w:sdtContent>` + content + `</w:sdtContent></w:sdt>`
+}
+
+func TestFillTextControls(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t xml:space="preserve">Name: </w:t></w:r>`+
+		inlineControl("name", `<w:alias w:val="Client name"/><w:showingPlcHdr/>`,
+			`<w:r><w:rPr><w:rStyle w:val="PlaceholderText"/><w:b/></w:rPr><w:t>Click here</w:t></w:r><w:r><w:t>to enter text.</w:t></w:r>`)+
+		`</w:p>`+
+		`<w:sdt><w:sdtPr><w:alias w:val="Address"/><w:richText/></w:sdtPr><w:sdtContent>`+
+		`<w:p><w:pPr><w:jc w:val="right"/></w:pPr><w:r><w:rPr><w:i/></w:rPr><w:t>Street</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>City</w:t></w:r></w:p><w:tbl><w:tr><w:tc><w:p><w:r><w:t>Map</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`+
+		`</w:sdtContent></w:sdt>`)
+	data := map[string]string{"name": "Arthur Dent", "Address": "155 Country Lane\nCottington"}
+	if err := d.FillContentControls(data, docx.ContentControlOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Name: |Arthur Dent|155 Country Lane|Cottington|Map", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	for _, s := range []string{"showingPlcHdr", "PlaceholderText"} {
+		if strings.Contains(d.Content, s) {
+			t.Errorf("expected %s to be removed, got %s", s, d.Content)
+		}
+	}
+	if strings.Count(d.Content, `<w:jc w:val="right">`) != 2 || strings.Count(d.Content, "<w:i>") != 2 || !strings.Contains(d.Content, "<w:b>") {
+		t.Errorf("expected the format to be kept, got %s", d.Content)
+	}
+}
+
+func TestFillControlTypes(t *testing.T) {
+	d := newTestDocx(t, `<w:p>`+
+		inlineControl("signed", `<w14:checkbox><w14:checked w14:val="0"/>`+
+			`<w14:checkedState w14:val="2612" w14:font="MS Gothic"/><w14:uncheckedState w14:val="2610" w14:font="MS Gothic"/></w14:checkbox>`,
+			`<w:r><w:t>☐</w:t></w:r>`)+
+		inlineControl("date", `<w:date><w:dateFormat w:val="d. MMMM yyyy"/><w:lid w:val="de-DE"/></w:date>`,
+			`<w:r><w:t>Datum</w:t></w:r>`)+
+		inlineControl("color", `<w:dropDownList><w:listItem w:displayText="Choose" w:value=""/>`+
+			`<w:listItem w:displayText="Red" w:value="r"/><w:listItem w:displayText="Green" w:value="g"/></w:dropDownList>`,
+			`<w:r><w:t>Choose</w:t></w:r>`)+
+		inlineControl("size", `<w:comboBox><w:listItem w:displayText="Small" w:value="S"/></w:comboBox>`,
+			`<w:r><w:t>Size</w:t></w:r>`)+
+		`</w:p>`)
+	data := map[string]interface{}{
+		"signed": true,
+		"date":   time.Date(2017, 3, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600)),
+		"color":  "g",
+		"size":   "XXL",
+	}
+	if err := d.FillContentControls(data, docx.ContentControlOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "☒|1. März 2017|Green|XXL", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	for _, s := range []string{`<w14:checked w14:val="1">`, `w:fullDate="2017-03-01T00:00:00Z"`, `w:lastValue="g"`} {
+		if !strings.Contains(d.Content, s) {
+			t.Errorf("expected %s, got %s", s, d.Content)
+		}
+	}
+
+	if err := d.SetContentControl("color", "Blue"); err == nil || !strings.Contains(err.Error(), `no item "Blue"`) {
+		t.Errorf("expected an error for an unknown item, got %v", err)
+	}
+	if err := d.SetContentControl("unknown", "x"); err == nil {
+		t.Error("expected an error for an unknown content control")
+	}
+}
+
+func TestFillRepeatingSection(t *testing.T) {
+	item := func(name string) string {
+		return `<w:sdt><w:sdtPr><w15:repeatingSectionItem/></w:sdtPr><w:sdtContent>` +
+			`<w:tr><w:tc><w:p>` + inlineControl("name", "", `<w:r><w:t>`+name+`</w:t></w:r>`) + `</w:p></w:tc>` +
+			`<w:tc><w:p>` + inlineControl("qty", "", `<w:r><w:t>0</w:t></w:r>`) + `</w:p></w:tc></w:tr>` +
+			`</w:sdtContent></w:sdt>`
+	}
+	d := newTestDocx(t, `<w:tbl><w:sdt`+controlNamespaces+`><w:sdtPr><w:tag w:val="items"/><w15:repeatingSection/></w:sdtPr>`+
+		`<w:sdtContent>`+item("Article")+item("Other")+`</w:sdtContent></w:sdt></w:tbl>`)
+	data := map[string]interface{}{"items": []map[string]interface{}{
+		{"name": "Towel", "qty": 1},
+		{"name": "Guide", "qty": 42},
+	}}
+	if err := d.FillContentControls(data, docx.ContentControlOptions{RemoveControls: true}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Towel|1|Guide|42", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if strings.Contains(d.Content, "sdt") || strings.Count(d.Content, "<w:tr>") != 2 {
+		t.Errorf("expected two rows without content controls, got %s", d.Content)
+	}
+}
@@ -0,0 +1,529 @@
+package docx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"xml"
+)
+
+const (
+	customXMLNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/customXml"
+	customXMLPropsType = "application/vnd.openxmlformats-officedocument.customXmlProperties+xml"
+	customXMLPrefix    = "ns0"
+)
+
+var customXMLPartPattern = regexp.MustCompile(`^customXml/item[0-9]+\.xml$`)
+var prefixMappingPattern = regexp.MustCompile(`xmlns:([^=\s]+)\s*=\s*['"]([^'"]*)['"]`)
+
+// CustomXML is a custom XML part. Content controls that are bound to the
+// part by a <w:dataBinding> show the values of its elements.
+type CustomXML struct {
+	// ID is the store item id of the part, e.g. "{6C3C8BC8-F283-45AE-878A-BAB7291924A1}",
+	// which the data bindings refer to. If it is empty, the part with the same
+	// root element is replaced, or a part with a new id is added.
+	ID string
+	// Namespace and Root are the namespace and the local name of the root element.
+	Namespace, Root string
+	// Data is the content of the root element. Map keys and struct fields become
+	// elements, named like the placeholders of Render, and each element of a
+	// slice repeats the element of the slice.
+	Data interface{}
+}
+
+// datastoreItem is the properties part of a custom XML part.
+type datastoreItem struct {
+	XMLName xml.Name `xml:"http://schemas.openxmlformats.org/officeDocument/2006/customXml datastoreItem"`
+	ItemID  string   `xml:"http://schemas.openxmlformats.org/officeDocument/2006/customXml itemID,attr"`
+}
+
+// customXMLItem is a custom XML part of the package.
+type customXMLItem struct {
+	name, props string // names of the part and of its properties part
+	id          string
+	root        *element
+}
+
+// SetCustomXML adds a custom XML part, or replaces the content of an existing
+// one, and refreshes the content controls bound to custom XML parts so they
+// show the new values. It returns the store item id of the part.
+func (d *Docx) SetCustomXML(part CustomXML) (string, error) {
+	if part.Root == "" {
+		return "", errors.New("custom XML part has no root element")
+	}
+	content, err := encodeCustomXML(part)
+	if err != nil {
+		return "", err
+	}
+	items, err := d.customXMLItems()
+	if err != nil {
+		return "", err
+	}
+	var item *customXMLItem
+	for _, i := range items {
+		if part.ID != "" && strings.EqualFold(i.id, part.ID) ||
+			part.ID == "" && i.root != nil && i.root.Name == (xml.Name{Space: part.Namespace, Local: part.Root}) {
+			item = i
+			break
+		}
+	}
+
+	backup := copyFiles(d.changed)
+	id, err := d.writeCustomXML(item, part, content)
+	if err == nil {
+		err = d.refreshDataBindings()
+	}
+	if err != nil {
+		d.changed = backup
+		return "", err
+	}
+	return id, nil
+}
+
+// writeCustomXML writes the content and the properties of a custom XML part.
+// A new part is added if item is nil.
+func (d *Docx) writeCustomXML(item *customXMLItem, part CustomXML, content []byte) (string, error) {
+	if item == nil {
+		item = &customXMLItem{name: d.newPartName("customXml/item", ".xml")}
+		if _, err := d.addRelationship(documentPart, relationshipCustomXML, "../"+item.name, false); err != nil {
+			return "", err
+		}
+	}
+	if item.props == "" {
+		item.props = path.Join(path.Dir(item.name), "itemProps"+strings.TrimPrefix(path.Base(item.name), "item"))
+		if _, err := d.addRelationship(item.name, relationshipItemProps, path.Base(item.props), false); err != nil {
+			return "", err
+		}
+		if err := d.addOverrideContentType("/"+item.props, customXMLPropsType); err != nil {
+			return "", err
+		}
+	}
+	if err := d.addDefaultContentType("xml", "application/xml"); err != nil {
+		return "", err
+	}
+
+	id := part.ID
+	if id == "" {
+		id = item.id
+	}
+	if id == "" {
+		var err error
+		if id, err = newItemID(); err != nil {
+			return "", err
+		}
+	}
+	props, err := encodeItemProps(id, part.Namespace)
+	if err != nil {
+		return "", err
+	}
+	d.setFile(item.name, content)
+	d.setFile(item.props, props)
+	return id, nil
+}
+
+// encodeItemProps encodes the properties part of a custom XML part.
+// Its attributes have to be qualified, which Marshal does not do.
+func encodeItemProps(id, namespace string) ([]byte, error) {
+	name := func(local string) xml.Name { return xml.Name{Space: customXMLNamespace, Local: local} }
+	item := xml.StartElement{Name: name("datastoreItem"), Attr: []xml.Attr{
+		{Name: xml.Name{Space: "xmlns", Local: "ds"}, Value: customXMLNamespace},
+		{Name: name("itemID"), Value: id},
+	}}
+	refs := xml.StartElement{Name: name("schemaRefs")}
+	tokens := []xml.Token{item, refs}
+	if namespace != "" {
+		ref := xml.StartElement{Name: name("schemaRef"), Attr: []xml.Attr{{Name: name("uri"), Value: namespace}}}
+		tokens = append(tokens, ref, ref.End())
+	}
+	tokens = append(tokens, refs.End(), item.End())
+
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	encoder := xml.NewEncoder(&buf)
+	encoder.PrefixElements(true)
+	encoder.Namespace("xmlns", "xmlns")
+	encoder.Namespace("ds", customXMLNamespace)
+	for _, t := range tokens {
+		if err := encoder.EncodeToken(t); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// customXMLItems returns the custom XML parts of the package.
+func (d *Docx) customXMLItems() ([]*customXMLItem, error) {
+	var items []*customXMLItem
+	for _, name := range d.fileNames() {
+		if !customXMLPartPattern.MatchString(name) {
+			continue
+		}
+		item := &customXMLItem{name: name}
+		data, _, err := d.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := readTokens(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, n := range buildTree(tokens) {
+			if el, ok := n.(*element); ok {
+				item.root = el
+				break
+			}
+		}
+
+		rels, err := d.readRelationships(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range rels.Relationship {
+			if rel.Type != relationshipItemProps {
+				continue
+			}
+			item.props = path.Join(path.Dir(name), rel.Target)
+			data, ok, err := d.readFile(item.props)
+			if err != nil {
+				return nil, err
+			}
+			props := &datastoreItem{}
+			if ok {
+				if err := xml.Unmarshal(data, props); err != nil {
+					return nil, fmt.Errorf("%s: %v", item.props, err)
+				}
+			}
+			item.id = props.ItemID
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// newItemID returns a random store item id.
+func newItemID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// encodeCustomXML encodes the content of a custom XML part.
+// The elements of the namespace are written with the prefix ns0, like Word does.
+func encodeCustomXML(part CustomXML) ([]byte, error) {
+	if _, ok := collection(part.Data); ok {
+		return nil, fmt.Errorf("custom XML part %q has a list as root", part.Root)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	encoder := xml.NewEncoder(&buf)
+	encoder.PrefixElements(true)
+	var attrs []xml.Attr
+	if part.Namespace != "" {
+		encoder.Namespace("xmlns", "xmlns")
+		encoder.Namespace(customXMLPrefix, part.Namespace)
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Space: "xmlns", Local: customXMLPrefix}, Value: part.Namespace})
+	}
+	if err := encodeCustomXMLElement(encoder, xml.Name{Space: part.Namespace, Local: part.Root}, part.Data, attrs...); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCustomXMLValue writes the element called name. The elements
+// of a collection are written as a sequence of elements called name.
+func encodeCustomXMLValue(encoder *xml.Encoder, name xml.Name, v interface{}) error {
+	items, ok := collection(v)
+	if !ok {
+		return encodeCustomXMLElement(encoder, name, v)
+	}
+	for _, item := range items {
+		if err := encodeCustomXMLElement(encoder, name, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCustomXMLElement writes a single element with the members or the text of v.
+func encodeCustomXMLElement(encoder *xml.Encoder, name xml.Name, v interface{}, attrs ...xml.Attr) error {
+	if !isXMLName(name.Local) {
+		return fmt.Errorf("%q is not a valid element name", name.Local)
+	}
+	start := xml.StartElement{Name: name, Attr: attrs}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	value := indirect(reflect.ValueOf(v))
+	switch {
+	case !value.IsValid():
+	case value.Kind() == reflect.Map || value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{}):
+		for _, m := range customXMLMembers(value) {
+			if err := encodeCustomXMLValue(encoder, xml.Name{Space: name.Space, Local: m.name}, m.value); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(customXMLText(value.Interface()))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+type customXMLMember struct {
+	name  string
+	value interface{}
+}
+
+// customXMLMembers returns the map entries, sorted by key, or the fields of a struct.
+// Struct fields are named by their docx tag, like in the data of Render.
+func customXMLMembers(v reflect.Value) []customXMLMember {
+	var members []customXMLMember
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			members = append(members, customXMLMember{key.String(), valueOf(v.MapIndex(key))})
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get(dataTag), ",")[0]
+			switch {
+			case tag == "-":
+			case f.Anonymous && tag == "":
+				if embedded := indirect(v.Field(i)); embedded.Kind() == reflect.Struct {
+					members = append(members, customXMLMembers(embedded)...)
+				}
+			case f.PkgPath != "":
+			default:
+				if tag == "" {
+					tag = f.Name
+				}
+				members = append(members, customXMLMember{tag, valueOf(v.Field(i))})
+			}
+		}
+	}
+	return members
+}
+
+// customXMLText returns the text of a value in the format of XML Schema.
+func customXMLText(v interface{}) string {
+	switch value := v.(type) {
+	case time.Time:
+		return value.Format("2006-01-02T15:04:05")
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return valueText(v)
+}
+
+// isXMLName reports whether s can be used as the name of an element.
+func isXMLName(s string) bool {
+	for i, c := range s {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c) && c != '-' && c != '.') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// refreshDataBindings sets the content of all content controls that are bound
+// to a custom XML part to the value selected by their XPath.
+func (d *Docx) refreshDataBindings() error {
+	items, err := d.customXMLItems()
+	if err != nil {
+		return err
+	}
+	contents := make(map[string]string)
+	for _, name := range d.PartNames() {
+		tokens, err := readTokens(d.part(name))
+		if err != nil {
+			return err
+		}
+		tree := buildTree(stripIgnorable(tokens))
+		refreshed, err := refreshBindings(tree, items)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if refreshed == 0 {
+			continue
+		}
+		if contents[name], err = encodeString(tree); err != nil {
+			return err
+		}
+	}
+	for name, content := range contents {
+		d.setPart(name, content)
+	}
+	return nil
+}
+
+// refreshBindings refreshes the bound controls within nodes and returns their number.
+func refreshBindings(nodes []xml.Token, items []*customXMLItem) (int, error) {
+	refreshed := 0
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			continue
+		}
+		if el.is("sdt") {
+			ok, err := refreshBinding(el, items)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				refreshed++
+				continue
+			}
+		}
+		count, err := refreshBindings(el.children, items)
+		if err != nil {
+			return 0, err
+		}
+		refreshed += count
+	}
+	return refreshed, nil
+}
+
+// refreshBinding sets the content of a bound control. Bindings without
+// store item id refer to the first part in which their XPath selects a value.
+func refreshBinding(sdt *element, items []*customXMLItem) (bool, error) {
+	props, content := sdt.child("sdtPr"), sdt.child("sdtContent")
+	if props == nil || content == nil || props.child("dataBinding") == nil {
+		return false, nil
+	}
+	binding := props.child("dataBinding").StartElement
+	storeItemID := attrValue(binding, "storeItemID")
+	prefixes := make(map[string]string)
+	for _, m := range prefixMappingPattern.FindAllStringSubmatch(attrValue(binding, "prefixMappings"), -1) {
+		prefixes[m[1]] = m[2]
+	}
+	for _, item := range items {
+		if item.root == nil || storeItemID != "" && !strings.EqualFold(item.id, storeItemID) {
+			continue
+		}
+		text, ok := selectXPath(item.root, attrValue(binding, "xpath"), prefixes)
+		if !ok {
+			continue
+		}
+		removePlaceholder(props)
+		var value interface{} = text
+		if findElement(props, w14Namespace, "checkbox") != nil {
+			value = text == "true" || text == "1"
+		}
+		if err := fillValue(props, content, value); err != nil {
+			return false, fmt.Errorf("content control bound to %q: %v", attrValue(binding, "xpath"), err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// selectXPath returns the text selected by an absolute XPath of the form
+// written by Word, e.g. "/ns0:contract[1]/ns0:client[1]/ns0:name[1]":
+// child elements with optional positions, optionally ending with an attribute.
+func selectXPath(root *element, xpath string, prefixes map[string]string) (string, bool) {
+	if !strings.HasPrefix(xpath, "/") {
+		return "", false
+	}
+	steps := strings.Split(xpath[1:], "/")
+	candidates := []xml.Token{root}
+	var current *element
+	for i, step := range steps {
+		if strings.HasPrefix(step, "@") && i > 0 && i == len(steps)-1 {
+			name, ok := xpathName(step[1:], prefixes)
+			if !ok {
+				return "", false
+			}
+			for _, a := range current.Attr {
+				if a.Name == name {
+					return a.Value, true
+				}
+			}
+			return "", false
+		}
+		name, position, ok := xpathStep(step, prefixes)
+		if !ok {
+			return "", false
+		}
+		current = nil
+		for _, c := range candidates {
+			if el, ok := c.(*element); ok && el.Name == name {
+				if position--; position == 0 {
+					current = el
+					break
+				}
+			}
+		}
+		if current == nil {
+			return "", false
+		}
+		candidates = current.children
+	}
+	return xmlText(current), true
+}
+
+// xpathStep returns the element name and the position of a step like "ns0:item[2]".
+func xpathStep(step string, prefixes map[string]string) (xml.Name, int, bool) {
+	position := 1
+	if i := strings.IndexByte(step, '['); i >= 0 {
+		if !strings.HasSuffix(step, "]") {
+			return xml.Name{}, 0, false
+		}
+		n, err := strconv.Atoi(step[i+1 : len(step)-1])
+		if err != nil || n < 1 {
+			return xml.Name{}, 0, false
+		}
+		step, position = step[:i], n
+	}
+	name, ok := xpathName(step, prefixes)
+	return name, position, ok
+}
+
+// xpathName resolves the prefix of a name like "ns0:item".
+func xpathName(name string, prefixes map[string]string) (xml.Name, bool) {
+	i := strings.IndexByte(name, ':')
+	if i < 0 {
+		return xml.Name{Local: name}, name != ""
+	}
+	space, ok := prefixes[name[:i]]
+	return xml.Name{Space: space, Local: name[i+1:]}, ok
+}
+
+// xmlText returns the character data of an element and its descendants.
+func xmlText(e *element) string {
+	var b strings.Builder
+	for _, c := range e.children {
+		switch node := c.(type) {
+		case xml.CharData:
+			b.Write(node)
+		case *element:
+			b.WriteString(xmlText(node))
+		}
+	}
+	return b.String()
+}
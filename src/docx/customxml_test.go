@@ -0,0 +1,92 @@
+package docx_test
+
+import (
+	"docx"
+	"strings"
+	"testing"
+	"time"
+)
+
+// boundControl returns an inline content control bound to the given XPath of the contract part.
+func boundControl(xpath, props, content string) string {
+	return `<w:sdt` + controlNamespaces + `><w:sdtPr>` + props +
+		`<w:dataBinding w:prefixMappings="xmlns:ns0='urn:contract'" w:xpath="` + xpath + `" w:storeItemID="{6C3C8BC8-F283-45AE-878A-BAB7291924A1}"/>` +
+		`</w:sdtPr><w:sdtContent>` + content + `</w:sdtContent></w:sdt>`
+}
+
+type contract struct {
+	Client struct {
+		Name string `docx:"name"`
+	} `docx:"client"`
+	Signed  time.Time `docx:"signed"`
+	Renewal bool      `docx:"renewal"`
+	Items   []string  `docx:"item"`
+}
+
+func TestSetCustomXML(t *testing.T) {
+	d := newTestDocx(t, `<w:p>`+
+		boundControl("/ns0:contract[1]/ns0:client[1]/ns0:name[1]", `<w:showingPlcHdr/>`, `<w:r><w:rPr><w:b/></w:rPr><w:t>Name</w:t></w:r>`)+
+		boundControl("/ns0:contract[1]/ns0:signed[1]", `<w:date><w:dateFormat w:val="dd.MM.yyyy"/></w:date>`, `<w:r><w:t>Date</w:t></w:r>`)+
+		boundControl("/ns0:contract[1]/ns0:renewal[1]", `<w14:checkbox><w14:checked w14:val="0"/></w14:checkbox>`, `<w:r><w:t>☐</w:t></w:r>`)+
+		boundControl("/ns0:contract[1]/ns0:item[2]", "", `<w:r><w:t>Item</w:t></w:r>`)+
+		`</w:p>`)
+
+	var data contract
+	data.Client.Name = "Arthur Dent"
+	data.Signed = time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	data.Renewal = true
+	data.Items = []string{"Towel", "Guide"}
+	part := docx.CustomXML{ID: "{6C3C8BC8-F283-45AE-878A-BAB7291924A1}", Namespace: "urn:contract", Root: "contract", Data: data}
+	id, err := d.SetCustomXML(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != part.ID {
+		t.Errorf("expected id %s, got %s", part.ID, id)
+	}
+	if expected, actual := "Arthur Dent|01.03.2017|☒|Guide", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if !strings.Contains(d.Content, "<w:dataBinding") || !strings.Contains(d.Content, "<w:b>") {
+		t.Errorf("expected the controls to keep their binding and format, got %s", d.Content)
+	}
+
+	files := writtenFiles(t, d)
+	item := `<ns0:contract xmlns:ns0="urn:contract"><ns0:client><ns0:name>Arthur Dent</ns0:name></ns0:client>` +
+		`<ns0:signed>2017-03-01T00:00:00</ns0:signed><ns0:renewal>true</ns0:renewal>` +
+		`<ns0:item>Towel</ns0:item><ns0:item>Guide</ns0:item></ns0:contract>`
+	if !strings.Contains(files["customXml/item1.xml"], item) {
+		t.Errorf("expected %s, got %s", item, files["customXml/item1.xml"])
+	}
+	checks := map[string]string{
+		"customXml/itemProps1.xml":       `itemID="{6C3C8BC8-F283-45AE-878A-BAB7291924A1}"`,
+		"customXml/_rels/item1.xml.rels": `Target="itemProps1.xml"`,
+		"word/_rels/document.xml.rels":   `Target="../customXml/item1.xml"`,
+		"[Content_Types].xml":            `PartName="/customXml/itemProps1.xml"`,
+	}
+	for name, s := range checks {
+		if !strings.Contains(files[name], s) {
+			t.Errorf("expected %s in %s, got %s", s, name, files[name])
+		}
+	}
+
+	// a part with the same root element is updated
+	data.Client.Name = "Ford Prefect"
+	if id, err = d.SetCustomXML(docx.CustomXML{Namespace: "urn:contract", Root: "contract", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if id != part.ID || !strings.Contains(d.Content, "Ford Prefect") {
+		t.Errorf("expected the part %s to be updated, got %s and %s", part.ID, id, d.Content)
+	}
+	if _, ok := writtenFiles(t, d)["customXml/item2.xml"]; ok {
+		t.Error("expected no second custom XML part")
+	}
+}
+
+func TestSetCustomXMLInvalidName(t *testing.T) {
+	d := newTestDocx(t, `<w:p/>`)
+	_, err := d.SetCustomXML(docx.CustomXML{Root: "data", Data: map[string]string{"first name": "Arthur"}})
+	if err == nil || !strings.Contains(err.Error(), "not a valid element name") {
+		t.Errorf("expected an error for an invalid element name, got %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package docx
+
+import (
+	"encoding/json"
+	"iter"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// dataTag is the struct tag that names a field in templates,
+// e.g. `docx:"name"`. Fields tagged with `docx:"-"` are not visible.
+const dataTag = "docx"
+
+// metaPrefix starts the names of the loop metadata, e.g. «#number».
+const metaPrefix = "#"
+
+// scope resolves placeholder names. Names that are not found
+// in the innermost data are looked up in the enclosing loops.
+// A name may be a dotted path like "customer.address.city".
+type scope struct {
+	data   interface{}
+	path   string // path of the data, e.g. "order.line" for the elements of a nested loop
+	parent *scope
+	loop   *loopPosition // position of the data within its loop, nil outside of loops
+}
+
+// loopPosition is the position of an element within the data of a loop.
+// The count of a stream is not known, it is -1.
+type loopPosition struct {
+	index, count int
+	last         bool
+}
+
+// value returns the loop metadata called name (without the "#" prefix):
+// index (from 0), number (from 1), count, first, last, odd and even.
+// The first element is odd.
+func (p *loopPosition) value(name string) (interface{}, bool) {
+	switch name {
+	case "index":
+		return p.index, true
+	case "number":
+		return p.index + 1, true
+	case "count":
+		return p.count, p.count >= 0
+	case "first":
+		return p.index == 0, true
+	case "last":
+		return p.last, true
+	case "odd":
+		return p.index%2 == 0, true
+	case "even":
+		return p.index%2 == 1, true
+	}
+	return nil, false
+}
+
+// lookup returns the value called name and its path within the data.
+// Names starting with "#" refer to the metadata of the innermost loop.
+func (s *scope) lookup(name string) (interface{}, string, bool) {
+	if strings.HasPrefix(name, metaPrefix) {
+		for ; s != nil; s = s.parent {
+			if s.loop != nil {
+				v, ok := s.loop.value(strings.TrimPrefix(name, metaPrefix))
+				return v, joinPath(s.path, name), ok
+			}
+		}
+		return nil, "", false
+	}
+	path := strings.Split(name, ".")
+	for ; s != nil; s = s.parent {
+		data := reflect.ValueOf(s.data)
+		if v, ok := member(data, name); ok && len(path) > 1 {
+			return valueOf(v), joinPath(s.path, name), true
+		}
+		v, ok := member(data, path[0])
+		if !ok {
+			continue
+		}
+		for _, key := range path[1:] {
+			if v, ok = member(v, key); !ok {
+				return nil, "", false
+			}
+		}
+		return valueOf(v), joinPath(s.path, name), true
+	}
+	return nil, "", false
+}
+
+// joinPath appends name to a data path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// indirect dereferences pointers and interfaces.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// member returns the map entry or struct field called name.
+func member(v reflect.Value, name string) (reflect.Value, bool) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return v, false
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return value, false
+		}
+		return indirect(value), true
+	case reflect.Struct:
+		return structField(v, name)
+	}
+	return reflect.Value{}, false
+}
+
+// structField returns the field of a struct that is tagged with name,
+// or, if there is no such tag, the field whose name matches name.
+// Fields of embedded structs are promoted.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	var byName, byFold reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+		tag := strings.Split(f.Tag.Get(dataTag), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			if embedded := indirect(v.Field(i)); embedded.Kind() == reflect.Struct {
+				if value, ok := structField(embedded, name); ok && !byName.IsValid() {
+					byName = value
+				}
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		switch {
+		case tag == name:
+			return indirect(v.Field(i)), true
+		case tag == "" && f.Name == name:
+			byName = v.Field(i)
+		case tag == "" && !byFold.IsValid() && strings.EqualFold(f.Name, name):
+			byFold = v.Field(i)
+		}
+	}
+	if byName.IsValid() {
+		return indirect(byName), true
+	}
+	if byFold.IsValid() {
+		return indirect(byFold), true
+	}
+	return reflect.Value{}, false
+}
+
+// collection returns the elements of a loop value,
+// i.e. of any slice or array except byte slices.
+func collection(v interface{}) ([]interface{}, bool) {
+	value := indirect(reflect.ValueOf(v))
+	if !value.IsValid() {
+		return nil, false
+	}
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, false
+	}
+	if value.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	items := make([]interface{}, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items, true
+}
+
+// sequence is the data of a loop, whose elements are received one by one.
+type sequence struct {
+	next  func() (interface{}, bool)
+	stop  func()
+	count int // number of elements, -1 for streams
+}
+
+// elements returns the elements of a collection or a stream.
+func elements(v interface{}) (*sequence, bool) {
+	if items, ok := collection(v); ok {
+		i := 0
+		next := func() (interface{}, bool) {
+			if i == len(items) {
+				return nil, false
+			}
+			i++
+			return items[i-1], true
+		}
+		return &sequence{next: next, stop: func() {}, count: len(items)}, true
+	}
+	return stream(v)
+}
+
+// isStream reports whether v is a stream: a channel to receive from or an
+// iterator function like iter.Seq.
+func isStream(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	if !value.IsValid() || value.Kind() != reflect.Chan && value.Kind() != reflect.Func || value.IsNil() {
+		return false
+	}
+	t := value.Type()
+	if t.Kind() == reflect.Chan {
+		return t.ChanDir()&reflect.RecvDir != 0
+	}
+	if t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
+
+// stream returns the elements of a stream. They can only be received once.
+func stream(v interface{}) (*sequence, bool) {
+	if !isStream(v) {
+		return nil, false
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Chan {
+		next := func() (interface{}, bool) {
+			item, ok := value.Recv()
+			if !ok {
+				return nil, false
+			}
+			return item.Interface(), true
+		}
+		return &sequence{next: next, stop: func() {}, count: -1}, true
+	}
+	yieldType := value.Type().In(0)
+	next, stop := iter.Pull(func(yield func(interface{}) bool) {
+		value.Call([]reflect.Value{reflect.MakeFunc(yieldType, func(args []reflect.Value) []reflect.Value {
+			return []reflect.Value{reflect.ValueOf(yield(args[0].Interface()))}
+		})})
+	})
+	return &sequence{next: next, stop: stop, count: -1}, true
+}
+
+// each calls f for each element and its position until f returns false.
+// The next element is received before f is called to know whether the element is the last.
+func (q *sequence) each(f func(item interface{}, position *loopPosition) bool) {
+	defer q.stop()
+	item, ok := q.next()
+	for i := 0; ok; i++ {
+		next, more := q.next()
+		if !f(item, &loopPosition{index: i, count: q.count, last: !more}) {
+			return
+		}
+		item, ok = next, more
+	}
+}
+
+// isTrue reports whether a condition value is met: a true bool,
+// a non-empty string, a non-empty collection or map, or a non-zero number,
+// including a json.Number.
+// Other values are met if they are not nil.
+func isTrue(v interface{}) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return err != nil || f != 0
+	}
+	value := indirect(reflect.ValueOf(v))
+	if !value.IsValid() {
+		return false
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() != 0
+	}
+	return true
+}
+
+// valueTypes are the structs that are rendered as a whole, not by their fields.
+var valueTypes = map[reflect.Type]bool{
+	reflect.TypeOf(Image{}):     true,
+	reflect.TypeOf(Hyperlink{}): true,
+	reflect.TypeOf(time.Time{}): true,
+}
+
+// dataKeys calls visit for all map keys and struct fields within v.
+// The keys of the elements of a collection share the path of the collection.
+// Images, hyperlinks and times are values without keys.
+func dataKeys(v reflect.Value, path string, visit func(path string)) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			keyPath := joinPath(path, key.String())
+			visit(keyPath)
+			dataKeys(v.MapIndex(key), keyPath, visit)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		if valueTypes[t] {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get(dataTag), ",")[0]
+			switch {
+			case tag == "-":
+			case f.Anonymous && tag == "":
+				dataKeys(v.Field(i), path, visit)
+			case f.PkgPath != "":
+			default:
+				if tag == "" {
+					tag = f.Name
+				}
+				keyPath := joinPath(path, tag)
+				visit(keyPath)
+				dataKeys(v.Field(i), keyPath, visit)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			dataKeys(v.Index(i), path, visit)
+		}
+	}
+}
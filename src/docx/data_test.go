@@ -0,0 +1,74 @@
+package docx_test
+
+import (
+	"testing"
+)
+
+type testAddress struct {
+	Street string
+	City   string `docx:"city"`
+}
+
+type testLine struct {
+	Article string  `docx:"article"`
+	Price   float64 `docx:"price"`
+}
+
+type testCustomer struct {
+	Name    string `docx:"name"`
+	Address *testAddress
+	secret  string
+}
+
+type testInvoice struct {
+	testCustomer
+	Number  int         `docx:"number"`
+	Lines   []testLine  `docx:"line"`
+	Notes   []string    `docx:"-"`
+	Paid    bool        `docx:"paid"`
+	Details interface{} `docx:"details"`
+}
+
+func TestRenderStruct(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«number» «name», «Address.Street», «address.city»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«start:line»</w:t></w:r><w:r><w:t>«article»: «price» («name»)</w:t></w:r><w:r><w:t>«end:line»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«if:paid»</w:t></w:r><w:r><w:t>paid</w:t></w:r><w:r><w:t>«else:paid»</w:t></w:r><w:r><w:t>open</w:t></w:r><w:r><w:t>«endif:paid»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«details.vat.rate» «secret» «Notes»</w:t></w:r></w:p>`)
+
+	invoice := &testInvoice{
+		testCustomer: testCustomer{
+			Name:    "Arthur Dent",
+			Address: &testAddress{Street: "Country Lane 1", City: "Cottington"},
+			secret:  "towel",
+		},
+		Number: 42,
+		Lines:  []testLine{{"Towel", 9.5}, {"Guide", 42}},
+		Notes:  []string{"hidden"},
+		Details: map[string]interface{}{
+			"vat": map[string]string{"rate": "19%"},
+		},
+	}
+	if err := d.Render(invoice); err != nil {
+		t.Fatal(err)
+	}
+	expected := "42| |Arthur Dent|, |Country Lane 1|, |Cottington|" +
+		"Towel|: |9.5| (|Arthur Dent|)|Guide|: |42| (|Arthur Dent|)|" +
+		"open|19%| |«secret»| |«Notes»"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderMap(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:topic»</w:t></w:r><w:r><w:t>«title» «missing»</w:t></w:r><w:r><w:t>«end:topic»</w:t></w:r></w:p>`)
+	data := map[string]interface{}{
+		"topic": []map[string]interface{}{{"title": "One"}, {"title": nil}},
+	}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := "One| |«missing»|| |«missing»"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
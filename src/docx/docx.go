@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -16,34 +17,66 @@ const mergeFieldOpenTag = "«"
 const mergeFieldCloseTag = "»"
 const loopStartPrefix = "start:"
 const loopEndPrefix = "end:"
+const conditionPrefix = "if:"
+const conditionElsePrefix = "else:"
+const conditionEndPrefix = "endif:"
+const columnStartPrefix = "startcol:"
+const columnEndPrefix = "endcol:"
 
 // ReplaceDocx represents a replacable docx
 type ReplaceDocx struct {
-	zipReader *zip.ReadCloser
-	content   string
+	files   []*zip.File
+	closer  io.Closer // resources owned by the docx, nil if there are none
+	content string
+	parts   map[string]string
 }
 
 // Editable returns a Docx
 func (r *ReplaceDocx) Editable() *Docx {
+	parts := make(map[string]string)
+	for name, content := range r.parts {
+		parts[name] = content
+	}
 	return &Docx{
-		files:   r.zipReader.File,
+		files:   r.files,
 		Content: r.content,
+		Parts:   parts,
 	}
 }
 
-// Close closes the zip reader
+// Close releases the resources the docx has opened: the file opened by
+// ReadDocxFile or ReadDocxFromFS, or the temporary copy made by ReadDocxFromReader.
+// Readers passed by the caller are not closed. The unchanged parts are
+// read when a Docx is written, so Close has to be called afterwards.
 func (r *ReplaceDocx) Close() error {
-	return r.zipReader.Close()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
 }
 
 // Docx represents a docx
 type Docx struct {
-	files   []*zip.File
+	files []*zip.File
+	// Content is the main document (word/document.xml)
 	Content string
+	// Parts holds the other story parts by name: headers, footers,
+	// footnotes, endnotes and comments (e.g. "word/header1.xml").
+	Parts map[string]string
+
+	changed   map[string][]byte // other parts that have been added or changed, e.g. media and relationships
+	removed   map[string]bool   // original parts that have been removed, e.g. replaced media
+	drawingID int               // largest id of the drawings, see nextDrawingID
+	stream    *streamRender     // story parts that are rendered by Write, see StreamRender
 }
 
-// Replace replaces a string
+// Replace replaces a string in all story parts, starting with the main document.
+// At most num strings are replaced, all of them if num < 0.
+// Placeholders split across several runs are found as well.
 func (d *Docx) Replace(oldString string, newString string, num int) (err error) {
+	if err = d.mergePlaceholderRuns(); err != nil {
+		return err
+	}
 	oldString, err = encode(oldString)
 	if err != nil {
 		return err
@@ -53,124 +86,88 @@ func (d *Docx) Replace(oldString string, newString string, num int) (err error)
 		return err
 	}
 
-	d.Content = strings.Replace(d.Content, mergeFieldOpenTag+oldString+mergeFieldCloseTag, newString, num)
+	oldString = mergeFieldOpenTag + oldString + mergeFieldCloseTag
+	for _, name := range d.PartNames() {
+		content := d.part(name)
+		count := strings.Count(content, oldString)
+		if num >= 0 && count > num {
+			count = num
+		}
+		d.setPart(name, strings.Replace(content, oldString, newString, count))
+		if num >= 0 {
+			num -= count
+		}
+	}
 	return nil
 }
 
-// ReplaceLoop iterates through the loop in docx
+// ReplaceLoop iterates through the loop in all story parts of docx
 // for each elemen tin the given data array.
 // During each run of the iteration, the loop placeholders are replaces with
 // the given values in the corresponding data element.
-func (d *Docx) ReplaceLoop(loopVarName string, data []map[string]string) (err error) {
-	newContent := ""
-	newBuffer := bytes.NewBufferString(newContent)
-	newTokens := make(map[string][]xml.Token)
-	decoder := xml.NewDecoder(strings.NewReader(d.Content))
-	encoder := xml.NewEncoder(newBuffer)
-	encoder.OptimizeNamespaces(true)
-	encoder.PrefixElements(true)
-	encoder.Namespace("w", "http://schemas.openxmlformats.org/wordprocessingml/2006/main")
-	encoder.Namespace("w14", "http://schemas.microsoft.com/office/word/2010/wordml")
-	encoder.Namespace("xmlns", "xmlns")
-	encoder.Namespace("wpc", "http://schemas.microsoft.com/office/word/2010/wordprocessingCanvas")
-	encoder.Namespace("mo", "http://schemas.microsoft.com/office/mac/office/2008/main")
-	encoder.Namespace("mc", "http://schemas.openxmlformats.org/markup-compatibility/2006")
-	encoder.Namespace("mv", "urn:schemas-microsoft-com:mac:vml")
-	encoder.Namespace("o", "urn:schemas-microsoft-com:office:office")
-	encoder.Namespace("r", "http://schemas.openxmlformats.org/officeDocument/2006/relationships")
-	encoder.Namespace("m", "http://schemas.openxmlformats.org/officeDocument/2006/math")
-	encoder.Namespace("v", "urn:schemas-microsoft-com:vml")
-	encoder.Namespace("wp14", "http://schemas.microsoft.com/office/word/2010/wordprocessingDrawing")
-	encoder.Namespace("wp", "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing")
-	encoder.Namespace("w10", "urn:schemas-microsoft-com:office:word")
-	encoder.Namespace("w", "http://schemas.openxmlformats.org/wordprocessingml/2006/main")
-	encoder.Namespace("w14", "http://schemas.microsoft.com/office/word/2010/wordml")
-	encoder.Namespace("w15", "http://schemas.microsoft.com/office/word/2012/wordml")
-	encoder.Namespace("wpg", "http://schemas.microsoft.com/office/word/2010/wordprocessingGroup")
-	encoder.Namespace("wpi", "http://schemas.microsoft.com/office/word/2010/wordprocessingInk")
-	encoder.Namespace("wne", "http://schemas.microsoft.com/office/word/2006/wordml")
-	encoder.Namespace("wps", "http://schemas.microsoft.com/office/word/2010/wordprocessingShape")
-
-	// pos indicates the position of the token
-	// "before" ... token is before the loop block
-	// "in"     ... token is part of the loop block
-	// "after"  ... token is after of th loop block
-	pos := "before"
-
-	// Parse document XML and partition tokens
-	// in 3 buckets: before-loop, in-loop, after-loop
-	for {
-		t, _ := decoder.Token()
-		if t == nil {
-			break
-		}
+// A loop between «startcol:name» and «endcol:name» markers in the cells of
+// a table row repeats the table columns of those cells instead of rows.
+// Within a loop, «#index», «#number», «#count», «#first», «#last», «#odd»
+// and «#even» give the position of the current element, e.g. for «if:#last».
+// The data is a []map[string]string, or a []map[string]interface{} whose
+// values may also be a Hyperlink or an *Image, e.g. to link each row to its record.
+func (d *Docx) ReplaceLoop(loopVarName string, data interface{}) (err error) {
+	if data == nil {
+		// no elements, not a missing loop
+		data = []map[string]string(nil)
+	}
+	return d.render(LoopElement{loopVarName: data}, RenderOptions{})
+}
 
-		switch node := t.(type) {
-		case xml.CharData:
-			if charData, ok := t.(xml.CharData); ok {
-				cd := strings.Trim(string([]byte(charData)), " ")
-				if cd == mergeFieldOpenTag+loopStartPrefix+loopVarName+mergeFieldCloseTag {
-					pos = "in"
-					continue
-				} else if cd == mergeFieldOpenTag+loopEndPrefix+loopVarName+mergeFieldCloseTag {
-					pos = "after"
-					continue
-				}
-			}
-		// WORKAROUND: The genereated document.xml is not fully valid
-		// however, MS Word manages to open it with a warning.
-		// In order to circumvent the warning, we have to skip the attribute "Ignorable"
-		// In the <document/> root element.
-		case xml.StartElement:
-			if node.Name.Local == "document" {
-				var newAttr []xml.Attr
-				for _, attr := range node.Attr {
-					if strings.ToLower(attr.Name.Local) != "ignorable" {
-						newAttr = append(newAttr, attr)
-					}
-				}
-				node.Attr = newAttr
-				t = node
-			}
-		}
+// ReplaceNestedLoop works like ReplaceLoop, but the loop elements may hold
+// the data of nested loops. A «start:name» ... «end:name» region inside the
+// loop is repeated for each element of the []LoopElement stored under "name".
+// Placeholders that are not found in a loop element are looked up in the
+// elements of the enclosing loops.
+func (d *Docx) ReplaceNestedLoop(loopVarName string, data []LoopElement) (err error) {
+	return d.render(LoopElement{loopVarName: data}, RenderOptions{})
+}
 
-		newTokens[pos] = append(newTokens[pos], xml.CopyToken(t))
-	}
-
-	// Copy the tokens before the loop (header)
-	for _, token := range newTokens["before"] {
-		encoder.EncodeToken(token)
-	}
-
-	// Iterate the loop tokens for each loop element
-	for _, loopElement := range data {
-		// Check if tokens have to be replaced with given data values
-		for _, token := range newTokens["in"] {
-			newToken := xml.CopyToken(token) // TODO: Do we need a copy here?
-			switch newToken.(type) {
-			case xml.CharData:
-				if charData, ok := newToken.(xml.CharData); ok {
-					cd := strings.Trim(string([]byte(charData)), " ")
-					if strings.HasPrefix(cd, "«") && strings.HasSuffix(cd, "»") {
-						key := cd[2 : len(cd)-2]
-						if val, ok := loopElement[key]; ok {
-							newToken = xml.CharData(val)
-						}
-					}
-				}
-			}
-			encoder.EncodeToken(newToken)
-		}
-	}
+// ReplaceCondition keeps or drops the «if:name» ... «endif:name» sections
+// in docx. If value is a true bool, a non-empty string or a non-empty
+// collection, the content before the optional «else:name» marker is kept,
+// otherwise the content after it.
+// Conditions inside loops are resolved with the data of the loop elements.
+func (d *Docx) ReplaceCondition(name string, value interface{}) (err error) {
+	return d.render(LoopElement{name: value}, RenderOptions{})
+}
 
-	// Copy the tokens after the loop
-	for _, token := range newTokens["after"] {
-		encoder.EncodeToken(token)
-	}
+// Render replaces all placeholders, loops and conditions in all story parts
+// of docx with the given data.
+// The data may be any Go value: structs, whose fields are named by the field
+// name or a `docx:"name"` tag, maps with string keys, slices and pointers
+// to those. Placeholders may use dotted paths like «customer.address.city»,
+// loops iterate slices and arrays. Placeholders without data are kept.
+// Values can be formatted within the placeholder, e.g. «amount|number:2»,
+// see Formatter. Placeholders in the document properties, e.g. in the
+// title, are replaced as well.
+func (d *Docx) Render(data interface{}) (err error) {
+	return d.render(data, RenderOptions{})
+}
 
-	encoder.Flush()
+// RenderWithOptions works like Render. The options determine how placeholders
+// without data are rendered, or make the render fail with a *RenderError
+// listing all placeholders without data and all unused data.
+// They also select the story parts that are rendered.
+// A failed render leaves the docx unchanged.
+func (d *Docx) RenderWithOptions(data interface{}, options RenderOptions) (err error) {
+	return d.render(data, options)
+}
 
-	d.Content = newBuffer.String()
+// mergePlaceholderRuns moves every placeholder of all story parts into a run of its own
+func (d *Docx) mergePlaceholderRuns() error {
+	for _, name := range d.PartNames() {
+		content, err := mergePlaceholderRuns(d.part(name))
+		if err != nil {
+			return err
+		}
+		d.setPart(name, content)
+	}
 	return nil
 }
 
@@ -186,28 +183,76 @@ func (d *Docx) WriteToFile(path string) (err error) {
 	return
 }
 
+// Write writes the docx as zip archive. Parts that have not been changed are
+// copied as they are, without decompressing them, so their size does not
+// matter. Changed parts are compressed again.
+// The story parts of a StreamRender are rendered first, straight into the archive.
 func (d *Docx) Write(ioWriter io.Writer) (err error) {
 	w := zip.NewWriter(ioWriter)
+	if err = d.writeStream(w); err != nil {
+		return err
+	}
 	for _, file := range d.files {
-		var writer io.Writer
-		var readCloser io.ReadCloser
-
-		writer, err = w.Create(file.Name)
-		if err != nil {
-			return err
+		if d.stream.contains(file.Name) || d.removed[file.Name] {
+			continue
 		}
-		readCloser, err = file.Open()
-		if err != nil {
+		data, changed := d.changedContent(file.Name)
+		if !changed {
+			if err = w.Copy(file); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = writeFile(w, changedHeader(file), data); err != nil {
 			return err
 		}
-		if file.Name == "word/document.xml" {
-			writer.Write([]byte(d.Content))
-		} else {
-			writer.Write(streamToByte(readCloser))
+	}
+	for _, name := range d.addedFiles() {
+		data, _ := d.changedContent(name)
+		if err = writeFile(w, &zip.FileHeader{Name: name, Method: zip.Deflate}, data); err != nil {
+			return err
 		}
 	}
-	w.Close()
-	return
+	return w.Close()
+}
+
+// changedContent returns the new content of a part that has been changed.
+// Story parts are always written again.
+func (d *Docx) changedContent(name string) ([]byte, bool) {
+	if name == documentPart {
+		return []byte(d.Content), true
+	}
+	if content, ok := d.Parts[name]; ok {
+		return []byte(content), true
+	}
+	data, ok := d.changed[name]
+	return data, ok
+}
+
+// changedHeader returns the header of a file whose content has been changed.
+func changedHeader(file *zip.File) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:           file.Name,
+		Comment:        file.Comment,
+		Method:         file.Method,
+		Modified:       file.Modified,
+		ExternalAttrs:  file.ExternalAttrs,
+		CreatorVersion: file.CreatorVersion,
+	}
+	if header.Method != zip.Store {
+		header.Method = zip.Deflate
+	}
+	return header
+}
+
+// writeFile adds a file to a zip archive.
+func writeFile(w *zip.Writer, header *zip.FileHeader, data []byte) error {
+	writer, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
 }
 
 // ReadDocxFile reads the file
@@ -216,27 +261,109 @@ func ReadDocxFile(path string) (*ReplaceDocx, error) {
 	if err != nil {
 		return nil, err
 	}
-	content, err := readText(reader.File)
+	return newReplaceDocx(reader.File, reader)
+}
+
+// ReadDoxFileFromBytes ...
+func ReadDoxFileFromBytes(zipBytes []byte) (*ReplaceDocx, error) {
+	return ReadDocxFromReaderAt(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+}
+
+// ReadDocxFromReaderAt reads a docx of the given size from r, e.g. an *os.File
+// or a reader of ranges of a remote object. Only the story parts are read
+// at once, the other parts when the docx is written. r stays owned by the
+// caller and has to be readable until then.
+func ReadDocxFromReaderAt(r io.ReaderAt, size int64) (*ReplaceDocx, error) {
+	reader, err := zip.NewReader(r, size)
 	if err != nil {
 		return nil, err
 	}
+	return newReplaceDocx(reader.File, nil)
+}
 
-	return &ReplaceDocx{zipReader: reader, content: content}, nil
+// ReadDocxFromReader reads a docx from r. Readers that can seek and read at
+// offsets, like *os.File, are used directly and stay owned by the caller.
+// Other readers are copied to a temporary file, which Close removes.
+func ReadDocxFromReader(r io.Reader) (*ReplaceDocx, error) {
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		return ReadDocxFromReaderAt(ra, size)
+	}
+
+	spool, err := ioutil.TempFile("", "docx-*.docx")
+	if err != nil {
+		return nil, err
+	}
+	temp := &tempFile{spool}
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		temp.Close()
+		return nil, err
+	}
+	reader, err := zip.NewReader(spool, size)
+	if err != nil {
+		temp.Close()
+		return nil, err
+	}
+	return newReplaceDocx(reader.File, temp)
 }
 
-// ReadDoxFileFromBytes ...
-func ReadDoxFileFromBytes(zipBytes []byte) (*ReplaceDocx, error) {
-	reader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+// ReadDocxFromFS reads the docx called name from a file system, e.g. an
+// embed.FS holding the templates of a program. Close closes the file.
+func ReadDocxFromFS(fsys fs.FS, name string) (*ReplaceDocx, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		defer f.Close()
+		return ReadDocxFromReader(f)
+	}
+	info, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	content, err := readText(reader.File)
+	reader, err := zip.NewReader(ra, info.Size())
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
+	return newReplaceDocx(reader.File, f)
+}
 
-	readCloser := &zip.ReadCloser{Reader: *reader}
-	return &ReplaceDocx{zipReader: readCloser, content: content}, nil
+// newReplaceDocx reads the story parts of a docx. The closer is closed if that fails.
+func newReplaceDocx(files []*zip.File, closer io.Closer) (*ReplaceDocx, error) {
+	r := &ReplaceDocx{files: files, closer: closer}
+	var err error
+	if r.content, err = readText(files); err == nil {
+		r.parts, err = readParts(files)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// tempFile is a temporary file that is removed when it is closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); err == nil {
+		err = removeErr
+	}
+	return err
 }
 
 func readText(files []*zip.File) (text string, err error) {
@@ -250,6 +377,7 @@ func readText(files []*zip.File) (text string, err error) {
 	if err != nil {
 		return text, err
 	}
+	defer documentReader.Close()
 
 	text, err = wordDocToString(documentReader)
 	return
@@ -265,7 +393,7 @@ func wordDocToString(reader io.Reader) (string, error) {
 
 func retrieveWordDoc(files []*zip.File) (file *zip.File, err error) {
 	for _, f := range files {
-		if f.Name == "word/document.xml" {
+		if f.Name == documentPart {
 			file = f
 		}
 	}
@@ -1,15 +1,40 @@
 package docx_test
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
 	"docx"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
+const testDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>`
+const testDocumentEnd = `</w:body></w:document>`
+
+var testPackageParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+		`</Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+		`</Relationships>`,
+}
+
 var (
 	RunDir string
 )
@@ -107,3 +132,169 @@ func TestReplace1(t *testing.T) {
 	f2.WriteString(docx1.Content)
 
 }
+
+// newTestPackage returns a docx package consisting of the given parts
+// and a minimal set of package parts.
+func newTestPackage(parts map[string]string) []byte {
+	all := make(map[string]string)
+	for name, content := range testPackageParts {
+		all[name] = content
+	}
+	for name, content := range parts {
+		all[name] = content
+	}
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		f.Write([]byte(all[name]))
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestDocx returns an editable docx with the given body XML.
+func newTestDocx(t *testing.T, body string) *docx.Docx {
+	return openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + body + testDocumentEnd,
+	}).Editable()
+}
+
+// openTestPackage returns a docx consisting of the given parts.
+func openTestPackage(t *testing.T, parts map[string]string) *docx.ReplaceDocx {
+	r, err := docx.ReadDoxFileFromBytes(newTestPackage(parts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWriteCopiesUnchangedParts(t *testing.T) {
+	modified := time.Date(2016, 5, 4, 10, 0, 0, 0, time.UTC)
+	media := bytes.Repeat([]byte("not compressed again "), 1000)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name   string
+		method uint16
+		data   []byte
+	}{
+		{"[Content_Types].xml", zip.Deflate, []byte(testPackageParts["[Content_Types].xml"])},
+		{"word/document.xml", zip.Deflate, []byte(testDocumentStart + `<w:p><w:r><w:t>«name»</w:t></w:r></w:p>` + testDocumentEnd)},
+		{"word/media/video.bin", zip.Store, media},
+	} {
+		writer, err := w.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method, Modified: modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(f.data)
+	}
+	w.Close()
+
+	r, err := docx.ReadDoxFileFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := r.Editable()
+	if err := d.Render(map[string]string{"name": "Arthur"}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	written, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range written.File {
+		if !f.Modified.Equal(modified) {
+			t.Errorf("expected %s to keep its time, got %v", f.Name, f.Modified)
+		}
+		if f.Name == "word/media/video.bin" && (f.Method != zip.Store || f.CompressedSize64 != uint64(len(media))) {
+			t.Errorf("expected %s to be copied uncompressed, got method %d and size %d", f.Name, f.Method, f.CompressedSize64)
+		}
+	}
+	if content := writtenFiles(t, d)["word/document.xml"]; !strings.Contains(content, "Arthur") {
+		t.Errorf("expected the rendered document, got %s", content)
+	}
+}
+
+// streamFS hides the io.ReaderAt of the files of a file system.
+type streamFS struct {
+	fs.FS
+}
+
+func (fsys streamFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestReadDocxFromReaders(t *testing.T) {
+	data := newTestPackage(map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>«name»</w:t></w:r></w:p>` + testDocumentEnd,
+	})
+	spool := t.TempDir()
+	t.Setenv("TMPDIR", spool)
+	mapFS := fstest.MapFS{"templates/letter.docx": {Data: data}}
+	for _, test := range []struct {
+		name    string
+		open    func() (*docx.ReplaceDocx, error)
+		spooled bool // whether the docx is copied to a temporary file
+	}{
+		{"ReaderAt", func() (*docx.ReplaceDocx, error) {
+			return docx.ReadDocxFromReaderAt(bytes.NewReader(data), int64(len(data)))
+		}, false},
+		{"seekable Reader", func() (*docx.ReplaceDocx, error) {
+			return docx.ReadDocxFromReader(bytes.NewReader(data))
+		}, false},
+		{"Reader", func() (*docx.ReplaceDocx, error) {
+			return docx.ReadDocxFromReader(struct{ io.Reader }{bytes.NewReader(data)})
+		}, true},
+		{"FS", func() (*docx.ReplaceDocx, error) {
+			return docx.ReadDocxFromFS(mapFS, "templates/letter.docx")
+		}, false},
+		{"FS without ReaderAt", func() (*docx.ReplaceDocx, error) {
+			return docx.ReadDocxFromFS(streamFS{mapFS}, "templates/letter.docx")
+		}, true},
+	} {
+		r, err := test.open()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if files, _ := ioutil.ReadDir(spool); (len(files) != 0) != test.spooled {
+			t.Errorf("%s: expected spooling %v, got %d temporary files", test.name, test.spooled, len(files))
+		}
+		d := r.Editable()
+		if err := d.Render(map[string]string{"name": "Arthur"}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		content := writtenFiles(t, d)["word/document.xml"]
+		if !strings.Contains(content, "Arthur") {
+			t.Errorf("%s: expected the replaced document, got %s", test.name, content)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(spool); len(files) != 0 {
+		t.Errorf("expected the spooled copy to be removed, got %d files", len(files))
+	}
+	if _, err := docx.ReadDocxFromReader(strings.NewReader("no zip")); err == nil {
+		t.Error("expected an error for an invalid docx")
+	}
+}
@@ -0,0 +1,317 @@
+package docx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formatter converts the value of a placeholder, e.g. «amount|number:2».
+// The arguments follow the formatter name, separated by colons, and may be
+// quoted, e.g. «date|date:"02.01.2006 15:04"». Several formatters may be
+// chained: «name|trim|upper». The result is passed to the next formatter
+// and finally rendered as text.
+type Formatter func(value interface{}, args ...string) (interface{}, error)
+
+const (
+	formatSeparator = "|"
+	formatArgument  = ":"
+)
+
+// formatQuotes maps the quotes that may open an argument to their closing quotes.
+var formatQuotes = map[rune]rune{'"': '"', '\'': '\'', '“': '”', '„': '“', '‘': '’'}
+
+// formatters are the formatters added with RegisterFormatter.
+var formatters = struct {
+	sync.RWMutex
+	byName map[string]Formatter
+}{byName: make(map[string]Formatter)}
+
+// RegisterFormatter adds a named formatter that can be used in all templates.
+// It replaces a formatter of the same name, including the built-in ones:
+// upper, lower, title, trim, default, join, format, prefix, suffix and the locale-aware
+// date, number, currency and ordinal.
+func RegisterFormatter(name string, f Formatter) {
+	formatters.Lock()
+	defer formatters.Unlock()
+	formatters.byName[name] = f
+}
+
+// lookupFormatter returns a formatter by name. Formatters given in the
+// render options take precedence over the registered ones, which take
+// precedence over the built-in ones.
+func lookupFormatter(name string, options RenderOptions, locale *Locale) (Formatter, bool) {
+	if f, ok := options.Formatters[name]; ok {
+		return f, true
+	}
+	formatters.RLock()
+	f, ok := formatters.byName[name]
+	formatters.RUnlock()
+	if ok {
+		return f, true
+	}
+	return builtinFormatter(name, locale)
+}
+
+// builtinFormatter returns a built-in formatter for the given locale.
+func builtinFormatter(name string, locale *Locale) (Formatter, bool) {
+	switch name {
+	case "upper":
+		return formatString(strings.ToUpper), true
+	case "lower":
+		return formatString(strings.ToLower), true
+	case "title":
+		return formatString(titleCase), true
+	case "trim":
+		return formatString(strings.TrimSpace), true
+	case "default":
+		return formatDefault, true
+	case "join":
+		return formatJoin, true
+	case "format":
+		return formatPrintf, true
+	case "prefix":
+		return formatAffix(true), true
+	case "suffix":
+		return formatAffix(false), true
+	case "date":
+		return locale.formatDate, true
+	case "number":
+		return locale.formatNumber, true
+	case "currency":
+		return locale.formatCurrency, true
+	case "ordinal":
+		return locale.formatOrdinal, true
+	}
+	return nil, false
+}
+
+// formatCall is a formatter applied to a placeholder, with its arguments.
+type formatCall struct {
+	name string
+	args []string
+}
+
+// splitFormat splits the text of a placeholder like `amount|number:2`
+// into the name of the value and the formatters.
+func splitFormat(text string) (string, []formatCall, error) {
+	segments, err := splitQuoted(text, formatSeparator)
+	if err != nil {
+		return text, nil, err
+	}
+	name := strings.TrimSpace(segments[0])
+	var calls []formatCall
+	for _, segment := range segments[1:] {
+		parts, err := splitQuoted(segment, formatArgument)
+		if err != nil {
+			return name, nil, err
+		}
+		call := formatCall{name: strings.TrimSpace(parts[0])}
+		if call.name == "" {
+			return name, nil, fmt.Errorf("placeholder %q has an empty formatter", text)
+		}
+		for _, arg := range parts[1:] {
+			call.args = append(call.args, unquote(arg))
+		}
+		calls = append(calls, call)
+	}
+	return name, calls, nil
+}
+
+// splitQuoted splits text at every separator that is not quoted. A quote
+// opens at the start of an argument and is closed by its matching quote at
+// the end of the argument. Other quote characters, like the apostrophe in
+// «note|default:it's empty», are part of the text.
+func splitQuoted(text, separator string) ([]string, error) {
+	var parts []string
+	var closing rune // closing quote of the open quote
+	argument := true // whether c is at the start of an argument
+	start := 0
+	for i, c := range text {
+		switch {
+		case closing != 0:
+			if c == closing && quoteEnds(text[i+utf8.RuneLen(c):]) {
+				closing = 0
+			}
+			continue
+		case argument && formatQuotes[c] != 0:
+			closing = formatQuotes[c]
+		case strings.HasPrefix(text[i:], separator):
+			parts = append(parts, text[start:i])
+			start = i + len(separator)
+		}
+		argument = closing == 0 && (c == '|' || c == ':' || argument && unicode.IsSpace(c))
+	}
+	if closing != 0 {
+		return nil, fmt.Errorf("placeholder %q has an unterminated quote", text)
+	}
+	return append(parts, text[start:]), nil
+}
+
+// quoteEnds reports whether a closing quote followed by rest ends an argument.
+func quoteEnds(rest string) bool {
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	return rest == "" || strings.HasPrefix(rest, formatSeparator) || strings.HasPrefix(rest, formatArgument)
+}
+
+// unquote removes the quotes around an argument, or the spaces around an unquoted one.
+func unquote(arg string) string {
+	trimmed := strings.TrimSpace(arg)
+	first, firstSize := utf8.DecodeRuneInString(trimmed)
+	last, lastSize := utf8.DecodeLastRuneInString(trimmed)
+	if closing := formatQuotes[first]; closing != 0 && closing == last && len(trimmed) >= firstSize+lastSize {
+		return trimmed[firstSize : len(trimmed)-lastSize]
+	}
+	return trimmed
+}
+
+// hasDefault reports whether a placeholder has a default value for missing data.
+func (f *field) hasDefault() bool {
+	for _, call := range f.format {
+		if call.name == "default" {
+			return true
+		}
+	}
+	return false
+}
+
+// format applies the formatters of a placeholder to a value.
+func (r *renderer) format(f *field, v interface{}) (interface{}, error) {
+	if f.formatErr != nil {
+		return nil, f.formatErr
+	}
+	for _, call := range f.format {
+		formatter, ok := lookupFormatter(call.name, r.options, r.locale)
+		if !ok {
+			return nil, fmt.Errorf("placeholder %q: unknown formatter %q", f.name, call.name)
+		}
+		var err error
+		if v, err = formatter(v, call.args...); err != nil {
+			return nil, fmt.Errorf("placeholder %q: %s: %v", f.name, call.name, err)
+		}
+	}
+	return v, nil
+}
+
+// formatString returns a formatter that converts the text of a value.
+func formatString(convert func(string) string) Formatter {
+	return func(value interface{}, args ...string) (interface{}, error) {
+		return convert(valueText(value)), nil
+	}
+}
+
+// titleCase makes the first letter of every word upper case.
+func titleCase(s string) string {
+	runes := []rune(s)
+	for i, c := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToTitle(c)
+		}
+	}
+	return string(runes)
+}
+
+// formatDefault replaces nil values and empty strings with its argument.
+func formatDefault(value interface{}, args ...string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected the default value as argument")
+	}
+	if value == nil || valueText(value) == "" {
+		return args[0], nil
+	}
+	return value, nil
+}
+
+func decimalsArgument(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	decimals, err := strconv.Atoi(args[0])
+	if err != nil || decimals < 0 {
+		return 0, fmt.Errorf("invalid number of decimals %q", args[0])
+	}
+	return decimals, nil
+}
+
+// numberValue converts a value to a number. Nil values and empty strings are not converted.
+func numberValue(value interface{}) (float64, bool, error) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false, fmt.Errorf("%q is not a number", n)
+		}
+		return f, true, nil
+	}
+	v := indirect(reflect.ValueOf(value))
+	if !v.IsValid() {
+		return 0, false, nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true, nil
+	case reflect.String:
+		s := strings.TrimSpace(v.String())
+		if s == "" {
+			return 0, false, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%q is not a number", s)
+		}
+		return f, true, nil
+	}
+	return 0, false, fmt.Errorf("%v is not a number", value)
+}
+
+// formatJoin joins the elements of a collection, separated by ", " by default.
+func formatJoin(value interface{}, args ...string) (interface{}, error) {
+	separator := ", "
+	if len(args) > 0 {
+		separator = args[0]
+	}
+	items, ok := collection(value)
+	if !ok {
+		return value, nil
+	}
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = valueText(item)
+	}
+	return strings.Join(texts, separator), nil
+}
+
+// formatPrintf formats a value with a fmt verb, e.g. «#number|format:"%02d"».
+func formatPrintf(value interface{}, args ...string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected the format as argument")
+	}
+	return fmt.Sprintf(args[0], value), nil
+}
+
+// formatAffix returns a formatter that adds its argument before or after
+// a value that is not empty, like the \b and \f switches of Word's MERGEFIELD.
+func formatAffix(before bool) Formatter {
+	return func(value interface{}, args ...string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("expected the text as argument")
+		}
+		text := valueText(value)
+		switch {
+		case text == "":
+			return text, nil
+		case before:
+			return args[0] + text, nil
+		}
+		return text + args[0], nil
+	}
+}
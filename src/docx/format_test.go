@@ -0,0 +1,91 @@
+package docx_test
+
+import (
+	"docx"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatters(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«date|date:"02.01.2006 15:04"»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«amount|number:2»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«name | trim | upper»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«tags|join:“ / ”»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«note|default:"n/a"»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«start:topic»</w:t></w:r><w:r><w:t>TOP «#number|format:"%02d"» «title|title»</w:t></w:r><w:r><w:t>«end:topic»</w:t></w:r></w:p>`)
+	data := map[string]interface{}{
+		"date":   time.Date(2017, 1, 1, 8, 0, 0, 0, time.UTC),
+		"amount": 1234.5,
+		"name":   " arthur ",
+		"tags":   []string{"towel", "guide"},
+		"topic":  []map[string]string{{"title": "the meaning of life"}},
+	}
+	if err := d.RenderWithOptions(data, docx.RenderOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "01.01.2017 08:00|1234.50|ARTHUR|towel / guide|n/a|TOP |01| |The Meaning Of Life"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestCustomFormatters(t *testing.T) {
+	docx.RegisterFormatter("stars", func(value interface{}, args ...string) (interface{}, error) {
+		return "*" + value.(string) + "*", nil
+	})
+	d := newTestDocx(t, `<w:p><w:r><w:t>«name|stars» «price|currency:EUR»</w:t></w:r></w:p>`)
+	options := docx.RenderOptions{Formatters: map[string]docx.Formatter{
+		"currency": func(value interface{}, args ...string) (interface{}, error) {
+			return value.(string) + " " + strings.Join(args, ""), nil
+		},
+	}}
+	if err := d.RenderWithOptions(map[string]string{"name": "Arthur", "price": "42"}, options); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "*Arthur*| |42 EUR", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestUnknownFormatter(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«name|unknown»</w:t></w:r></w:p>`)
+	if err := d.Render(map[string]string{"name": "Arthur"}); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected an error for an unknown formatter, got %v", err)
+	}
+}
+
+func TestFormatterQuotes(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«note|default:it's empty»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«note|default:"it's empty"»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«note|default:‘l’an’»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«note|default:'say "hi"'»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«date|date:2 January, l’an 2006»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«date|date:„15:04“»</w:t></w:r></w:p>`)
+	data := map[string]interface{}{"date": time.Date(2017, 1, 1, 8, 0, 0, 0, time.UTC)}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := `it&#39;s empty|it&#39;s empty|l’an|say &#34;hi&#34;|1 January, l’an 2017|08:00`
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	d = newTestDocx(t, `<w:p><w:r><w:t>«note|default:"it's empty»</w:t></w:r></w:p>`)
+	warnings := d.Lint()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "unterminated quote") {
+		t.Errorf("expected a warning for the unterminated quote, got %+v", warnings)
+	}
+}
+
+func TestFormatJSONNumbers(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«amount|number:2» «day|ordinal» «if:count»items«endif:count»</w:t></w:r></w:p>`)
+	data := map[string]interface{}{"amount": json.Number("1234.5"), "day": json.Number("3"), "count": json.Number("0")}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "1234.50| |3rd| ", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,140 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"xml"
+)
+
+const hyperlinkStyle = "Hyperlink"
+
+// Hyperlink is a value that renders a placeholder as a clickable link.
+// A Hyperlink or *Hyperlink can be used as a value in the data of Render,
+// also in the elements of loops, and in the loop elements of ReplaceLoop
+// and ReplaceNestedLoop.
+type Hyperlink struct {
+	// URL is the target of the link.
+	URL string
+	// Text is the text of the link. It defaults to the URL.
+	Text string
+	// Style is the character style of the link. It defaults to "Hyperlink".
+	Style string
+	// RunProperties formats the link text instead of the placeholder format
+	// and the style, e.g. `<w:color w:val="0000FF"/><w:u w:val="single"/>`.
+	// It is the content of a <w:rPr> element.
+	RunProperties string
+}
+
+// hyperlinkValue returns the hyperlink of a data value.
+func hyperlinkValue(v interface{}) (*Hyperlink, bool) {
+	switch link := v.(type) {
+	case *Hyperlink:
+		return link, link != nil
+	case Hyperlink:
+		return &link, true
+	}
+	return nil, false
+}
+
+// renderHyperlink replaces the run of a placeholder with a <w:hyperlink>.
+func (r *renderer) renderHyperlink(f *field, link *Hyperlink) ([]xml.Token, error) {
+	if f.run == nil {
+		return nil, fmt.Errorf("hyperlink placeholder %q is not in a run of its own", f.name)
+	}
+	if link.URL == "" {
+		return nil, fmt.Errorf("hyperlink %q has no URL", f.name)
+	}
+	id, err := r.docx.hyperlinkRelationship(r.part, link.URL)
+	if err != nil {
+		return nil, fmt.Errorf("hyperlink %q: %v", f.name, err)
+	}
+
+	text := link.Text
+	if text == "" {
+		text = link.URL
+	}
+	run := f.run.copy()
+	for i, c := range run.children {
+		if el, ok := c.(*element); ok && el.is("t") {
+			run.children[i] = newTextElement(text)
+		}
+	}
+	if link.RunProperties != "" {
+		props, err := parseRunProperties(link.RunProperties)
+		if err != nil {
+			return nil, fmt.Errorf("hyperlink %q: %v", f.name, err)
+		}
+		setRunProperties(run, props)
+	} else {
+		style := link.Style
+		if style == "" {
+			style = hyperlinkStyle
+		}
+		setRunStyle(run, style)
+	}
+
+	hyperlink := newWordElement("hyperlink",
+		xml.Attr{Name: xml.Name{Space: "xmlns", Local: "r"}, Value: relationshipsNS},
+		xml.Attr{Name: xml.Name{Space: relationshipsNS, Local: "id"}, Value: id},
+		xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "history"}, Value: "1"})
+	hyperlink.children = []xml.Token{run}
+	return []xml.Token{hyperlink}, nil
+}
+
+// hyperlinkRelationship returns the id of the external relationship from part to url.
+// Links to the same URL share a relationship.
+func (d *Docx) hyperlinkRelationship(part, url string) (string, error) {
+	rels, err := d.readRelationships(part)
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationship {
+		if rel.Type == relationshipHyperlink && rel.TargetMode == "External" && rel.Target == url {
+			return rel.ID, nil
+		}
+	}
+	return d.addRelationship(part, relationshipHyperlink, url, true)
+}
+
+// parseRunProperties parses the content of a <w:rPr> element.
+func parseRunProperties(content string) (*element, error) {
+	tokens, err := readTokens(`<w:rPr xmlns:w="` + wordNamespace + `">` + content + `</w:rPr>`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run properties: %v", err)
+	}
+	nodes := buildTree(tokens)
+	if len(nodes) != 1 {
+		return nil, errors.New("invalid run properties")
+	}
+	props := nodes[0].(*element)
+	props.Attr = nil
+	return props, nil
+}
+
+// setRunProperties replaces the <w:rPr> of a run.
+func setRunProperties(run *element, props *element) {
+	children := []xml.Token{props}
+	for _, c := range run.children {
+		if el, ok := c.(*element); !ok || !el.is("rPr") {
+			children = append(children, c)
+		}
+	}
+	run.children = children
+}
+
+// setRunStyle sets the character style of a run. The style has to be
+// the first of the run properties.
+func setRunStyle(run *element, style string) {
+	props := run.child("rPr")
+	if props == nil {
+		props = newWordElement("rPr")
+		run.children = append([]xml.Token{props}, run.children...)
+	}
+	children := []xml.Token{newWordElement("rStyle", xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "val"}, Value: style})}
+	for _, c := range props.children {
+		if el, ok := c.(*element); !ok || !el.is("rStyle") {
+			children = append(children, c)
+		}
+	}
+	props.children = children
+}
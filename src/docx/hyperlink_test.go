@@ -0,0 +1,98 @@
+package docx_test
+
+import (
+	"docx"
+	"strings"
+	"testing"
+)
+
+func TestRenderHyperlink(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>See «site»</w:t></w:r></w:p>`)
+	link := docx.Hyperlink{URL: "https://example.com/?a=1&b=2", Text: "Example"}
+	if err := d.Render(map[string]interface{}{"site": link}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<w:hyperlink xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:id="rId1" w:history="1">` +
+		`<w:r><w:rPr><w:rStyle w:val="Hyperlink"></w:rStyle><w:b></w:b></w:rPr><w:t>Example</w:t></w:r></w:hyperlink>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+	rels := writtenFiles(t, d)["word/_rels/document.xml.rels"]
+	if !strings.Contains(rels, `Target="https://example.com/?a=1&amp;b=2" TargetMode="External"`) {
+		t.Errorf("expected an external relationship, got %s", rels)
+	}
+}
+
+func TestRenderHyperlinkInLoop(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:record»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«link»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:record»</w:t></w:r></w:p>`)
+	records := []docx.LoopElement{
+		{"link": &docx.Hyperlink{URL: "https://example.com/1", RunProperties: `<w:color w:val="0000FF"/>`}},
+		{"link": &docx.Hyperlink{URL: "https://example.com/2"}},
+		{"link": &docx.Hyperlink{URL: "https://example.com/1"}},
+	}
+	if err := d.ReplaceNestedLoop("record", records); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "https://example.com/1|https://example.com/2|https://example.com/1", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	for _, expected := range []string{`r:id="rId1"`, `r:id="rId2"`, `<w:rPr><w:color w:val="0000FF"></w:color></w:rPr>`} {
+		if !strings.Contains(d.Content, expected) {
+			t.Errorf("expected %s in %s", expected, d.Content)
+		}
+	}
+	if strings.Contains(writtenFiles(t, d)["word/_rels/document.xml.rels"], "rId3") {
+		t.Errorf("expected links to the same URL to share a relationship")
+	}
+}
+
+func TestReplaceLoopHyperlink(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:record»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«name»: «link»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:record»</w:t></w:r></w:p>`)
+	records := []map[string]interface{}{
+		{"name": "Arthur", "link": docx.Hyperlink{URL: "https://example.com/arthur", Text: "Profile"}},
+		{"name": "Ford", "link": &docx.Hyperlink{URL: "https://example.com/ford", Text: "Profile"}},
+	}
+	if err := d.ReplaceLoop("record", records); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Arthur|: |Profile|Ford|: |Profile", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	for _, expected := range []string{`r:id="rId1" w:history="1"`, `r:id="rId2" w:history="1"`} {
+		if !strings.Contains(d.Content, expected) {
+			t.Errorf("expected %s in %s", expected, d.Content)
+		}
+	}
+}
+
+func TestRenderHyperlinkInTableLoop(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«start:customer»«name»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«site»</w:t></w:r><w:r><w:t>«end:customer»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	type customer struct {
+		Name string
+		Site docx.Hyperlink
+	}
+	customers := []customer{
+		{"Arthur", docx.Hyperlink{URL: "https://example.com/arthur", Text: "Profile"}},
+		{"Ford", docx.Hyperlink{URL: "https://example.com/ford", Text: "Profile"}},
+	}
+	if err := d.Render(map[string]interface{}{"customer": customers}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Arthur|Profile|Ford|Profile", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if count := strings.Count(d.Content, "<w:hyperlink "); count != 2 {
+		t.Errorf("expected a hyperlink per row, got %d in %s", count, d.Content)
+	}
+	rels := writtenFiles(t, d)["word/_rels/document.xml.rels"]
+	for _, url := range []string{"https://example.com/arthur", "https://example.com/ford"} {
+		if !strings.Contains(rels, url) {
+			t.Errorf("expected a relationship to %s, got %s", url, rels)
+		}
+	}
+}
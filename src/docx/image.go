@@ -0,0 +1,561 @@
+package docx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF for image.DecodeConfig
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"xml"
+)
+
+// Lengths in EMU (English Metric Units), the unit of image sizes.
+const (
+	EMUPerInch       = 914400
+	EMUPerCentimeter = 360000
+	EMUPerPoint      = 12700
+)
+
+const defaultDPI = 96
+
+const (
+	drawingNamespace   = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	pictureNamespace   = "http://schemas.openxmlformats.org/drawingml/2006/picture"
+	wordDrawingNS      = "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"
+	relationshipsNS    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	svgNamespace       = "http://schemas.microsoft.com/office/drawing/2016/SVG/main"
+	svgBlipExtensionID = "{96DAC541-7B7A-43D3-8B79-37D633B846F1}"
+)
+
+// Image is a picture that is inserted at a placeholder or replaces an existing picture.
+// An *Image can be used as a value in the data of Render.
+type Image struct {
+	// Data is the PNG, JPEG, GIF or SVG image.
+	Data []byte
+	// Fallback is a PNG image that is shown by Word versions that cannot
+	// display SVG images. It is required for SVG images.
+	Fallback []byte
+	// Width and Height are the size of the picture in EMU. If both are zero,
+	// the size is computed from the pixel size and DPI of the image. If one
+	// of them is zero, it is computed keeping the aspect ratio.
+	Width, Height int64
+	// DPI is the resolution used to compute the size from the pixel size.
+	// It defaults to 96.
+	DPI int
+	// Description is the alternative text of the picture.
+	Description string
+}
+
+// ReadImageFile reads an image from a file.
+func ReadImageFile(path string) (*Image, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Data: data}, nil
+}
+
+// imageFormat is the file format of an image.
+type imageFormat struct {
+	extension   string
+	contentType string
+}
+
+var (
+	formatPNG  = imageFormat{"png", "image/png"}
+	formatJPEG = imageFormat{"jpeg", "image/jpeg"}
+	formatGIF  = imageFormat{"gif", "image/gif"}
+	formatSVG  = imageFormat{"svg", "image/svg+xml"}
+)
+
+// detectImageFormat determines the format of image data by its signature.
+func detectImageFormat(data []byte) (imageFormat, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG, nil
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return formatJPEG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return formatGIF, nil
+	case bytes.Contains(data[:min(len(data), 1024)], []byte("<svg")):
+		return formatSVG, nil
+	}
+	return imageFormat{}, errors.New("unsupported image format, expected PNG, JPEG, GIF or SVG")
+}
+
+var svgSizePattern = regexp.MustCompile(`^\s*([0-9.]+)\s*(px)?\s*$`)
+var svgRootPattern = regexp.MustCompile(`<svg[^>]*>`)
+var svgAttrPattern = regexp.MustCompile(`\s(width|height|viewBox)\s*=\s*["']([^"']*)["']`)
+
+// pixelSize returns the size of the image in pixels.
+func (img *Image) pixelSize(format imageFormat) (int, int, error) {
+	if format != formatSVG {
+		config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+		if err != nil {
+			return 0, 0, err
+		}
+		return config.Width, config.Height, nil
+	}
+
+	attrs := make(map[string]string)
+	for _, m := range svgAttrPattern.FindAllStringSubmatch(svgRootPattern.FindString(string(img.Data)), -1) {
+		attrs[m[1]] = m[2]
+	}
+	w, werr := parseSVGLength(attrs["width"])
+	h, herr := parseSVGLength(attrs["height"])
+	if werr == nil && herr == nil {
+		return w, h, nil
+	}
+	if box := strings.Fields(strings.Replace(attrs["viewBox"], ",", " ", -1)); len(box) == 4 {
+		w, werr = parseSVGLength(box[2])
+		h, herr = parseSVGLength(box[3])
+		if werr == nil && herr == nil {
+			return w, h, nil
+		}
+	}
+	if len(img.Fallback) > 0 {
+		config, _, err := image.DecodeConfig(bytes.NewReader(img.Fallback))
+		if err == nil {
+			return config.Width, config.Height, nil
+		}
+	}
+	return 0, 0, errors.New("size of the SVG image is unknown")
+}
+
+func parseSVGLength(s string) (int, error) {
+	m := svgSizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported SVG length %q", s)
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	return int(f + 0.5), err
+}
+
+// size returns the size of the picture in EMU.
+func (img *Image) size(format imageFormat) (int64, int64, error) {
+	if img.Width > 0 && img.Height > 0 {
+		return img.Width, img.Height, nil
+	}
+	w, h, err := img.pixelSize(format)
+	if err != nil {
+		return 0, 0, err
+	}
+	if w <= 0 || h <= 0 {
+		return 0, 0, errors.New("image has no size")
+	}
+	switch {
+	case img.Width > 0:
+		return img.Width, img.Width * int64(h) / int64(w), nil
+	case img.Height > 0:
+		return img.Height * int64(w) / int64(h), img.Height, nil
+	}
+	dpi := img.DPI
+	if dpi <= 0 {
+		dpi = defaultDPI
+	}
+	return int64(w) * EMUPerInch / int64(dpi), int64(h) * EMUPerInch / int64(dpi), nil
+}
+
+// embeddedImage is an image that has been added to the package.
+type embeddedImage struct {
+	part          string // the part the relationships belong to
+	id, svgID     string // relationship ids of the picture and the SVG
+	name          string
+	file, svgFile string // media files of the picture and the SVG
+	width, height int64
+}
+
+// embedImage adds an image to the media of the package and
+// creates the relationships of the given part.
+func (d *Docx) embedImage(part string, img *Image) (*embeddedImage, error) {
+	format, err := detectImageFormat(img.Data)
+	if err != nil {
+		return nil, err
+	}
+	embedded := &embeddedImage{part: part}
+	if embedded.width, embedded.height, err = img.size(format); err != nil {
+		return nil, err
+	}
+
+	picture, pictureFormat := img.Data, format
+	if format == formatSVG {
+		if len(img.Fallback) == 0 {
+			return nil, errors.New("SVG image without PNG fallback")
+		}
+		if picture, pictureFormat = img.Fallback, formatPNG; !bytes.HasPrefix(picture, []byte("\x89PNG")) {
+			return nil, errors.New("fallback of the SVG image is not a PNG")
+		}
+		if embedded.svgID, embedded.svgFile, err = d.addMedia(part, img.Data, formatSVG); err != nil {
+			return nil, err
+		}
+	}
+	if embedded.id, embedded.file, err = d.addMedia(part, picture, pictureFormat); err != nil {
+		return nil, err
+	}
+	embedded.name = strings.TrimPrefix(embedded.file, "word/media/")
+	return embedded, nil
+}
+
+// relateImage returns an image that has already been embedded with relationships
+// from another part to the same media files.
+func (d *Docx) relateImage(part string, embedded *embeddedImage) (*embeddedImage, error) {
+	related := *embedded
+	related.part = part
+	var err error
+	if embedded.svgFile != "" {
+		if related.svgID, err = d.addRelationship(part, relationshipImage, strings.TrimPrefix(embedded.svgFile, "word/"), false); err != nil {
+			return nil, err
+		}
+	}
+	if related.id, err = d.addRelationship(part, relationshipImage, strings.TrimPrefix(embedded.file, "word/"), false); err != nil {
+		return nil, err
+	}
+	return &related, nil
+}
+
+// addMedia adds a file to word/media and returns the relationship id
+// from part to the file, and the name of the file.
+func (d *Docx) addMedia(part string, data []byte, format imageFormat) (string, string, error) {
+	name := d.newPartName("word/media/image", "."+format.extension)
+	d.setFile(name, data)
+	if err := d.addDefaultContentType(format.extension, format.contentType); err != nil {
+		return "", "", err
+	}
+	target := strings.TrimPrefix(name, "word/")
+	id, err := d.addRelationship(part, relationshipImage, target, false)
+	return id, name, err
+}
+
+var drawingIDPattern = regexp.MustCompile(`docPr\b[^>]*\sid="([0-9]+)"`)
+
+// nextDrawingID returns a unique id for the properties of a new drawing.
+func (d *Docx) nextDrawingID() int {
+	if d.drawingID == 0 {
+		for _, name := range d.PartNames() {
+			for _, m := range drawingIDPattern.FindAllStringSubmatch(d.part(name), -1) {
+				if id, err := strconv.Atoi(m[1]); err == nil && id > d.drawingID {
+					d.drawingID = id
+				}
+			}
+		}
+	}
+	d.drawingID++
+	return d.drawingID
+}
+
+func newElement(space, local string, attrs ...xml.Attr) *element {
+	return &element{StartElement: xml.StartElement{Name: xml.Name{Space: space, Local: local}, Attr: attrs}}
+}
+
+func attr(local, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: local}, Value: value}
+}
+
+// add appends child elements and returns e.
+func (e *element) add(children ...*element) *element {
+	for _, c := range children {
+		e.children = append(e.children, c)
+	}
+	return e
+}
+
+// newDrawing creates the <w:drawing> element of an inline picture.
+func newDrawing(id int, description string, img *embeddedImage) *element {
+	cx, cy := strconv.FormatInt(img.width, 10), strconv.FormatInt(img.height, 10)
+	blip := newElement(drawingNamespace, "blip", xml.Attr{Name: xml.Name{Space: relationshipsNS, Local: "embed"}, Value: img.id})
+	if img.svgID != "" {
+		blip.add(svgExtension(img.svgID))
+	}
+
+	// the namespaces used with prefixes are declared here, because
+	// the root element of the part does not have to declare them.
+	drawing := newWordElement("drawing",
+		xml.Attr{Name: xml.Name{Space: "xmlns", Local: "wp"}, Value: wordDrawingNS},
+		xml.Attr{Name: xml.Name{Space: "xmlns", Local: "a"}, Value: drawingNamespace},
+		xml.Attr{Name: xml.Name{Space: "xmlns", Local: "pic"}, Value: pictureNamespace},
+		xml.Attr{Name: xml.Name{Space: "xmlns", Local: "r"}, Value: relationshipsNS})
+	return drawing.add(
+		newElement(wordDrawingNS, "inline", attr("distT", "0"), attr("distB", "0"), attr("distL", "0"), attr("distR", "0")).add(
+			newElement(wordDrawingNS, "extent", attr("cx", cx), attr("cy", cy)),
+			newElement(wordDrawingNS, "docPr", attr("id", strconv.Itoa(id)), attr("name", "Picture "+strconv.Itoa(id)), attr("descr", description)),
+			newElement(wordDrawingNS, "cNvGraphicFramePr").add(
+				newElement(drawingNamespace, "graphicFrameLocks", attr("noChangeAspect", "1")),
+			),
+			newElement(drawingNamespace, "graphic").add(
+				newElement(drawingNamespace, "graphicData", attr("uri", pictureNamespace)).add(
+					newElement(pictureNamespace, "pic").add(
+						newElement(pictureNamespace, "nvPicPr").add(
+							newElement(pictureNamespace, "cNvPr", attr("id", "0"), attr("name", img.name), attr("descr", description)),
+							newElement(pictureNamespace, "cNvPicPr"),
+						),
+						newElement(pictureNamespace, "blipFill").add(
+							blip,
+							newElement(drawingNamespace, "stretch").add(newElement(drawingNamespace, "fillRect")),
+						),
+						newElement(pictureNamespace, "spPr").add(
+							newElement(drawingNamespace, "xfrm").add(
+								newElement(drawingNamespace, "off", attr("x", "0"), attr("y", "0")),
+								newElement(drawingNamespace, "ext", attr("cx", cx), attr("cy", cy)),
+							),
+							newElement(drawingNamespace, "prstGeom", attr("prst", "rect")).add(newElement(drawingNamespace, "avLst")),
+						),
+					),
+				),
+			),
+		),
+	)
+}
+
+// svgExtension creates the blip extension that refers to an SVG image.
+func svgExtension(svgID string) *element {
+	return newElement(drawingNamespace, "extLst").add(
+		newElement(drawingNamespace, "ext", attr("uri", svgBlipExtensionID)).add(
+			newElement(svgNamespace, "svgBlip", xml.Attr{Name: xml.Name{Space: relationshipsNS, Local: "embed"}, Value: svgID}),
+		),
+	)
+}
+
+// imageValue returns the image of a data value.
+func imageValue(v interface{}) (*Image, bool) {
+	switch img := v.(type) {
+	case *Image:
+		return img, img != nil
+	case Image:
+		return &img, true
+	}
+	return nil, false
+}
+
+// renderImage returns the run of a placeholder with the placeholder replaced by a picture.
+func (r *renderer) renderImage(f *field, img *Image) ([]xml.Token, error) {
+	if f.run == nil {
+		return nil, fmt.Errorf("image placeholder %q is not in a run of its own", f.name)
+	}
+	embedded, err := r.docx.embedImage(r.part, img)
+	if err != nil {
+		return nil, fmt.Errorf("image %q: %v", f.name, err)
+	}
+	run := f.run.copy()
+	for i, c := range run.children {
+		if el, ok := c.(*element); ok && el.is("t") {
+			run.children[i] = newDrawing(r.docx.nextDrawingID(), img.Description, embedded)
+		}
+	}
+	return []xml.Token{run}, nil
+}
+
+// ReplaceImage replaces the existing pictures whose alternative text
+// (or title or name) is description with the given image, in all story parts.
+// Unless the image has an explicit size, it is fitted into the box of each
+// picture, keeping its aspect ratio. The image is stored once, however many
+// pictures show it, and the replaced media are removed from the package if
+// nothing else uses them.
+func (d *Docx) ReplaceImage(description string, img *Image) error {
+	backup := d.snapshot()
+	replaced := 0
+	var embedded *embeddedImage
+	for _, name := range d.PartNames() {
+		err := d.replaceImages(name, description, img, &embedded, &replaced)
+		if err != nil {
+			d.restore(backup)
+			return err
+		}
+	}
+	if replaced == 0 {
+		return fmt.Errorf("image %q not found", description)
+	}
+	return nil
+}
+
+// replaceImages replaces the pictures of a single story part and counts them.
+// The image is embedded with the first picture and related from later parts.
+func (d *Docx) replaceImages(part string, description string, img *Image, embedded **embeddedImage, replaced *int) error {
+	tokens, err := readTokens(d.part(part))
+	if err != nil {
+		return err
+	}
+	tree := buildTree(stripIgnorable(tokens))
+	drawings := findDrawings(tree, description)
+	if len(drawings) == 0 {
+		return nil
+	}
+	switch {
+	case *embedded == nil:
+		*embedded, err = d.embedImage(part, img)
+	case (*embedded).part != part:
+		*embedded, err = d.relateImage(part, *embedded)
+	}
+	if err != nil {
+		return err
+	}
+	var old []string
+	for _, drawing := range drawings {
+		ids, err := replacePicture(drawing, img, *embedded)
+		if err != nil {
+			return err
+		}
+		old = append(old, ids...)
+	}
+	used := make(map[string]bool)
+	relationshipIDs(tree, used)
+	for _, id := range old {
+		if !used[id] {
+			if err := d.removeRelationship(part, id); err != nil {
+				return err
+			}
+			used[id] = true
+		}
+	}
+	var buf bytes.Buffer
+	encoder := newEncoder(&buf)
+	if err := encodeTree(encoder, tree); err != nil {
+		return err
+	}
+	encoder.Flush()
+	d.setPart(part, buf.String())
+	*replaced += len(drawings)
+	return nil
+}
+
+// relationshipIDs collects the relationship ids that are referred to by the nodes.
+func relationshipIDs(nodes []xml.Token, ids map[string]bool) {
+	for _, n := range nodes {
+		if el, ok := n.(*element); ok {
+			for _, a := range el.Attr {
+				if a.Name.Space == relationshipsNS {
+					ids[a.Value] = true
+				}
+			}
+			relationshipIDs(el.children, ids)
+		}
+	}
+}
+
+// findDrawings returns the <w:drawing> elements with the given description.
+func findDrawings(nodes []xml.Token, description string) []*element {
+	var result []*element
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			continue
+		}
+		if el.is("drawing") {
+			if props := findElement(el, wordDrawingNS, "docPr"); props != nil {
+				for _, a := range props.Attr {
+					if (a.Name.Local == "descr" || a.Name.Local == "title" || a.Name.Local == "name") && a.Value == description {
+						result = append(result, el)
+						break
+					}
+				}
+			}
+			continue
+		}
+		result = append(result, findDrawings(el.children, description)...)
+	}
+	return result
+}
+
+// findElement returns the first element below e with the given name.
+func findElement(e *element, space, local string) *element {
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok {
+			if el.Name.Space == space && el.Name.Local == local {
+				return el
+			}
+			if found := findElement(el, space, local); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// replacePicture makes a drawing show an embedded image and returns the
+// relationship ids of the pictures it showed before.
+func replacePicture(drawing *element, img *Image, embedded *embeddedImage) ([]string, error) {
+	blip := findElement(drawing, drawingNamespace, "blip")
+	if blip == nil {
+		return nil, errors.New("drawing without picture")
+	}
+	var old []string
+	var attrs []xml.Attr
+	for _, a := range blip.Attr {
+		if a.Name.Space != relationshipsNS || (a.Name.Local != "embed" && a.Name.Local != "link") {
+			attrs = append(attrs, a)
+		} else {
+			old = append(old, a.Value)
+		}
+	}
+	blip.Attr = append(attrs, xml.Attr{Name: xml.Name{Space: relationshipsNS, Local: "embed"}, Value: embedded.id})
+	var children []xml.Token
+	for _, c := range blip.children {
+		if el, ok := c.(*element); !ok || el.Name.Space != drawingNamespace || el.Name.Local != "extLst" {
+			children = append(children, c)
+		} else if svg := findElement(el, svgNamespace, "svgBlip"); svg != nil {
+			for _, a := range svg.Attr {
+				if a.Name.Space == relationshipsNS && a.Name.Local == "embed" {
+					old = append(old, a.Value)
+				}
+			}
+		}
+	}
+	blip.children = children
+	if embedded.svgID != "" {
+		blip.add(svgExtension(embedded.svgID))
+	}
+
+	extent := findElement(drawing, wordDrawingNS, "extent")
+	width, height := embedded.width, embedded.height
+	if img.Width == 0 && img.Height == 0 && extent != nil {
+		width, height = fitSize(width, height, extent)
+	}
+	cx, cy := strconv.FormatInt(width, 10), strconv.FormatInt(height, 10)
+	sizes := []*element{extent}
+	// the size of the picture shape, not the extensions of the drawing properties
+	if shape := findElement(drawing, pictureNamespace, "spPr"); shape != nil {
+		if xfrm := findElement(shape, drawingNamespace, "xfrm"); xfrm != nil {
+			sizes = append(sizes, findElement(xfrm, drawingNamespace, "ext"))
+		}
+	}
+	for _, size := range sizes {
+		if size == nil {
+			continue
+		}
+		for i, a := range size.Attr {
+			switch a.Name.Local {
+			case "cx":
+				size.Attr[i].Value = cx
+			case "cy":
+				size.Attr[i].Value = cy
+			}
+		}
+	}
+	return old, nil
+}
+
+// fitSize scales a size to fit into the extent of a picture, keeping its aspect ratio.
+// The size is kept if the extent has none.
+func fitSize(width, height int64, extent *element) (int64, int64) {
+	var cx, cy int64
+	for _, a := range extent.Attr {
+		switch a.Name.Local {
+		case "cx":
+			cx, _ = strconv.ParseInt(a.Value, 10, 64)
+		case "cy":
+			cy, _ = strconv.ParseInt(a.Value, 10, 64)
+		}
+	}
+	if cx <= 0 || cy <= 0 || width <= 0 || height <= 0 {
+		return width, height
+	}
+	if width*cy > height*cx {
+		return cx, height * cx / width
+	}
+	return width * cy / height, cy
+}
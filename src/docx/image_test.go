@@ -0,0 +1,223 @@
+package docx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"docx"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func newTestPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writtenFiles writes the docx and returns the content of its files.
+func writtenFiles(t *testing.T, d *docx.Docx) map[string]string {
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestRenderImage(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>Logo: «logo»</w:t></w:r></w:p>`)
+	logo := &docx.Image{Data: newTestPNG(t, 96, 48), Description: "Company logo"}
+	if err := d.Render(map[string]interface{}{"logo": logo}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<w:rPr><w:b></w:b></w:rPr><w:drawing`,
+		`<wp:extent cx="914400" cy="457200"></wp:extent>`,
+		`descr="Company logo"`,
+		`r:embed="rId1"`,
+	} {
+		if !strings.Contains(d.Content, expected) {
+			t.Errorf("expected %s in %s", expected, d.Content)
+		}
+	}
+	if strings.Contains(d.Content, "«logo»") {
+		t.Errorf("expected the placeholder to be replaced, got %s", d.Content)
+	}
+
+	files := writtenFiles(t, d)
+	if _, ok := files["word/media/image1.png"]; !ok {
+		t.Errorf("expected the image in the package")
+	}
+	if rels := files["word/_rels/document.xml.rels"]; !strings.Contains(rels, `Target="media/image1.png"`) {
+		t.Errorf("expected a relationship to the image, got %s", rels)
+	}
+	if types := files["[Content_Types].xml"]; !strings.Contains(types, `Extension="png"`) {
+		t.Errorf("expected a content type for png, got %s", types)
+	}
+
+	// the drawing is encoded again by the next render
+	if err := d.Render(map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, `<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>`) {
+		t.Errorf("expected prefixed drawing elements, got %s", d.Content)
+	}
+	checkWellFormed(t, writtenFiles(t, d))
+}
+
+func TestRenderImageInLoop(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:photo»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«image»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:photo»</w:t></w:r></w:p>`)
+	photos := []map[string]interface{}{
+		{"image": &docx.Image{Data: newTestPNG(t, 10, 10), Width: 2 * docx.EMUPerCentimeter}},
+		{"image": docx.Image{Data: newTestPNG(t, 20, 10)}},
+	}
+	if err := d.Render(map[string]interface{}{"photo": photos}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`cx="720000" cy="720000"`, `r:embed="rId1"`, `r:embed="rId2"`, `id="1"`, `id="2"`} {
+		if !strings.Contains(d.Content, expected) {
+			t.Errorf("expected %s in %s", expected, d.Content)
+		}
+	}
+	files := writtenFiles(t, d)
+	if _, ok := files["word/media/image2.png"]; !ok {
+		t.Errorf("expected two images in the package")
+	}
+}
+
+func TestRenderSVGImage(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«chart»</w:t></w:r></w:p>`)
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="192" height="96"><rect width="10" height="10"/></svg>`)
+	if err := d.Render(map[string]interface{}{"chart": &docx.Image{Data: svg}}); err == nil {
+		t.Errorf("expected an error for an SVG image without fallback")
+	}
+	if strings.Contains(d.Content, "drawing") {
+		t.Errorf("expected a failed render to leave the docx unchanged, got %s", d.Content)
+	}
+
+	chart := &docx.Image{Data: svg, Fallback: newTestPNG(t, 192, 96)}
+	if err := d.Render(map[string]interface{}{"chart": chart}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`cx="1828800" cy="914400"`, `svgBlip`, `{96DAC541-7B7A-43D3-8B79-37D633B846F1}`} {
+		if !strings.Contains(d.Content, expected) {
+			t.Errorf("expected %s in %s", expected, d.Content)
+		}
+	}
+	files := writtenFiles(t, d)
+	if types := files["[Content_Types].xml"]; !strings.Contains(types, `image/svg+xml`) {
+		t.Errorf("expected a content type for svg, got %s", types)
+	}
+}
+
+func TestReplaceImage(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«logo»</w:t></w:r></w:p><w:p><w:r><w:t>«footer»</w:t></w:r></w:p>`)
+	logo := &docx.Image{Data: newTestPNG(t, 96, 96), Description: "Logo"}
+	if err := d.Render(map[string]interface{}{"logo": logo, "footer": logo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReplaceImage("Logo", &docx.Image{Data: newTestPNG(t, 10, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(d.Content, `r:embed="rId3"`) != 2 || strings.Count(d.Content, `cx="457200" cy="914400"`) != 4 {
+		t.Errorf("expected both pictures to show the image fitted into their box, got %s", d.Content)
+	}
+	files := writtenFiles(t, d)
+	checkWellFormed(t, files)
+	for _, name := range []string{"word/media/image1.png", "word/media/image2.png", "word/media/image4.png"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("expected the image to be stored once, found %s", name)
+		}
+	}
+	if _, ok := files["word/media/image3.png"]; !ok {
+		t.Errorf("expected the new image in the package")
+	}
+	if err := d.ReplaceImage("Signature", &docx.Image{Data: newTestPNG(t, 10, 20)}); err == nil {
+		t.Errorf("expected an error for an unknown image")
+	}
+}
+
+const testPicture = `<w:p><w:r><w:drawing><wp:inline xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing">` +
+	`<wp:extent cx="100" cy="100"/>` +
+	`<wp:docPr id="1" name="Picture 1" descr="Logo"><a:extLst xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">` +
+	`<a:ext uri="{C183D7F6-B498-43B3-948B-1728B52AA6E4}"/></a:extLst></wp:docPr>` +
+	`<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">` +
+	`<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture">` +
+	`<pic:blipFill><a:blip xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:embed="rId1"/></pic:blipFill>` +
+	`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="100" cy="100"/></a:xfrm></pic:spPr>` +
+	`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>`
+
+const testPictureRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>` +
+	`</Relationships>`
+
+func TestReplaceImageSize(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml":            testDocumentStart + testPicture + testDocumentEnd,
+		"word/_rels/document.xml.rels": testPictureRels,
+		"word/media/image1.png":        string(newTestPNG(t, 1, 1)),
+	}).Editable()
+	if err := d.ReplaceImage("Logo", &docx.Image{Data: newTestPNG(t, 10, 20), Width: 200, Height: 400}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, `<wp:extent cx="200" cy="400">`) || !strings.Contains(d.Content, `cx="200" cy="400"></a:ext></a:xfrm>`) {
+		t.Errorf("expected the extent and the shape to be resized, got %s", d.Content)
+	}
+	if !strings.Contains(d.Content, `uri="{C183D7F6-B498-43B3-948B-1728B52AA6E4}"></a:ext></a:extLst></wp:docPr>`) {
+		t.Errorf("expected the extension of the drawing properties to be kept, got %s", d.Content)
+	}
+
+	files := writtenFiles(t, d)
+	checkWellFormed(t, files)
+	if _, ok := files["word/media/image1.png"]; ok {
+		t.Errorf("expected the replaced media to be removed")
+	}
+	if rels := files["word/_rels/document.xml.rels"]; strings.Contains(rels, `Id="rId1"`) || !strings.Contains(rels, "media/image2.png") {
+		t.Errorf("expected the relationship to be replaced, got %s", rels)
+	}
+}
+
+func TestReplaceImageRestoresParts(t *testing.T) {
+	// the picture in the footer has no blip, so replacing it fails after the main document
+	broken := strings.Replace(testPicture, `<a:blip xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:embed="rId1"/>`, "", 1)
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml":            testDocumentStart + testPicture + testDocumentEnd,
+		"word/_rels/document.xml.rels": testPictureRels,
+		"word/media/image1.png":        string(newTestPNG(t, 1, 1)),
+		"word/footer1.xml":             `<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` + broken + `</w:ftr>`,
+	}).Editable()
+	content := d.Content
+	if err := d.ReplaceImage("Logo", &docx.Image{Data: newTestPNG(t, 10, 20)}); err == nil {
+		t.Fatal("expected an error for the picture without blip")
+	}
+	if d.Content != content {
+		t.Errorf("expected the main document to be restored, got %s", d.Content)
+	}
+	if _, ok := writtenFiles(t, d)["word/media/image1.png"]; !ok {
+		t.Errorf("expected the media to be kept")
+	}
+}
@@ -0,0 +1,253 @@
+package docx
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"xml"
+)
+
+// Structure lists the placeholders, loops and conditions of a template.
+type Structure struct {
+	Placeholders []Placeholder `json:"placeholders,omitempty"`
+	Loops        []*Region     `json:"loops,omitempty"`
+	Conditions   []*Region     `json:"conditions,omitempty"`
+}
+
+// Placeholder is a single «placeholder» of a template.
+type Placeholder struct {
+	Name     string   `json:"name"`
+	Location Location `json:"location"`
+}
+
+// Region is a loop or a conditional section of a template.
+// The embedded structure lists the content of the region.
+type Region struct {
+	Name     string   `json:"name"`
+	Location Location `json:"location"`
+	Structure
+}
+
+// Location describes where a placeholder or the start marker of a region is found.
+type Location struct {
+	Part      string `json:"part"`      // name of the package part, e.g. "word/header1.xml"
+	Paragraph int    `json:"paragraph"` // index of the paragraph within the part
+	Text      string `json:"text"`      // text of the paragraph
+}
+
+// PackagePart is a file of the docx package.
+type PackagePart struct {
+	Name           string `json:"name"`
+	ContentType    string `json:"contentType"`
+	Size           uint64 `json:"size"`
+	CompressedSize uint64 `json:"compressedSize"` // 0 for parts that have been changed or added
+}
+
+// Relationship links a part of the package to another part or to an external target.
+type Relationship struct {
+	Source   string `json:"source"` // name of the part, empty for the package
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Target   string `json:"target"` // name of the target part, or the URL of an external target
+	External bool   `json:"external,omitempty"`
+}
+
+// Inspect parses the template and returns its structure.
+// All story parts are inspected: the main document, headers, footers,
+// footnotes, endnotes and comments.
+func (r *ReplaceDocx) Inspect() (*Structure, error) {
+	return r.Editable().Inspect()
+}
+
+// Inspect parses the docx and returns the structure of its placeholders,
+// loops and conditions. All story parts are inspected: the main document,
+// headers, footers, footnotes, endnotes and comments.
+func (d *Docx) Inspect() (*Structure, error) {
+	structure := &Structure{}
+	for _, name := range d.PartNames() {
+		if err := inspectPart(structure, name, d.part(name)); err != nil {
+			return nil, err
+		}
+	}
+	return structure, nil
+}
+
+// PackageParts lists the files of the docx package with their content types and sizes.
+func (d *Docx) PackageParts() ([]PackagePart, error) {
+	types, err := d.readContentTypes()
+	if err != nil {
+		return nil, err
+	}
+	var parts []PackagePart
+	for _, f := range d.files {
+		if d.removed[f.Name] {
+			continue
+		}
+		part := PackagePart{Name: f.Name, ContentType: types.contentType(f.Name), Size: f.UncompressedSize64, CompressedSize: f.CompressedSize64}
+		if data, changed := d.changedContent(f.Name); changed {
+			// story parts are always held in memory, compare them to the original
+			original, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(data, streamToByte(original)) {
+				part.Size, part.CompressedSize = uint64(len(data)), 0
+			}
+			original.Close()
+		}
+		parts = append(parts, part)
+	}
+	for _, name := range d.addedFiles() {
+		data, _ := d.changedContent(name)
+		parts = append(parts, PackagePart{Name: name, ContentType: types.contentType(name), Size: uint64(len(data))})
+	}
+	return parts, nil
+}
+
+// Relationships lists the relationships of all parts of the package,
+// starting with those of the package itself. If a relationships part
+// cannot be parsed, the relationships of the other parts are returned
+// together with the error.
+func (d *Docx) Relationships() ([]Relationship, error) {
+	var sources []string
+	for _, name := range d.fileNames() {
+		if strings.HasSuffix(name, ".rels") && path.Base(path.Dir(name)) == "_rels" {
+			source := path.Join(path.Dir(path.Dir(name)), strings.TrimSuffix(path.Base(name), ".rels"))
+			sources = append(sources, strings.TrimPrefix(source, "."))
+		}
+	}
+	sort.Strings(sources)
+	var result []Relationship
+	var failed error
+	for _, source := range sources {
+		rels, err := d.readRelationships(source)
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		for _, rel := range rels.Relationship {
+			r := Relationship{Source: source, ID: rel.ID, Type: rel.Type, Target: rel.Target, External: rel.TargetMode == "External"}
+			if !r.External {
+				r.Target = relationshipTarget(source, rel.Target)
+			}
+			result = append(result, r)
+		}
+	}
+	return result, failed
+}
+
+// relationshipTarget returns the name of the part an internal relationship
+// points to. Targets are URIs, so escapes like "%20" are decoded.
+func relationshipTarget(source, target string) string {
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(path.Dir(source), target)
+}
+
+// inspectPart adds the structure of a single part.
+func inspectPart(structure *Structure, part string, content string) error {
+	content, err := mergePlaceholderRuns(content)
+	if err != nil {
+		return err
+	}
+	tokens, err := readTokens(content)
+	if err != nil {
+		return err
+	}
+	nodes, err := parseTemplate(tokens)
+	if err != nil {
+		return err
+	}
+	i := &inspector{part: part, texts: paragraphTexts(tokens), regions: make(map[*field]*Region)}
+	i.inspect(structure, nodes)
+	return nil
+}
+
+// paragraphTexts returns the text of every paragraph of a part.
+func paragraphTexts(tokens []xml.Token) []string {
+	var texts []string
+	for _, runs := range paragraphRuns(tokens) {
+		texts = append(texts, strings.Join(runs, ""))
+	}
+	return texts
+}
+
+// paragraphRuns returns the texts of the <w:t> elements of every paragraph of a part.
+func paragraphRuns(tokens []xml.Token) [][]string {
+	var paragraphs [][]string
+	var stack []int
+	inText := false
+	for _, t := range tokens {
+		switch node := t.(type) {
+		case xml.StartElement:
+			if node.Name.Space == wordNamespace && node.Name.Local == "p" {
+				stack = append(stack, len(paragraphs))
+				paragraphs = append(paragraphs, nil)
+			}
+			inText = node.Name.Space == wordNamespace && node.Name.Local == "t"
+			if inText && len(stack) > 0 {
+				i := stack[len(stack)-1]
+				paragraphs[i] = append(paragraphs[i], "")
+			}
+		case xml.EndElement:
+			if node.Name.Space == wordNamespace && node.Name.Local == "p" && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			inText = false
+		case xml.CharData:
+			if inText && len(stack) > 0 {
+				texts := paragraphs[stack[len(stack)-1]]
+				texts[len(texts)-1] += string(node)
+			}
+		}
+	}
+	return paragraphs
+}
+
+// inspector walks a parsed template and locates its placeholders and regions.
+type inspector struct {
+	part    string
+	texts   []string
+	regions map[*field]*Region // regions by start marker, column loops are split into a loop per row
+}
+
+// location returns the location of a placeholder or region marker.
+func (i *inspector) location(f *field) Location {
+	location := Location{Part: i.part, Paragraph: f.paragraph}
+	if f.paragraph >= 0 && f.paragraph < len(i.texts) {
+		location.Text = i.texts[f.paragraph]
+	}
+	return location
+}
+
+func (i *inspector) inspect(structure *Structure, nodes []xml.Token) {
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *element:
+			i.inspect(structure, node.children)
+		case *field:
+			structure.Placeholders = append(structure.Placeholders, Placeholder{Name: node.name, Location: i.location(node)})
+		case *loop:
+			region, ok := i.regions[node.start]
+			if !ok {
+				region = &Region{Name: node.name, Location: i.location(node.start)}
+				i.regions[node.start] = region
+				structure.Loops = append(structure.Loops, region)
+			}
+			i.inspect(&region.Structure, node.body)
+		case *condition:
+			region := &Region{Name: node.name, Location: i.location(node.start)}
+			i.inspect(&region.Structure, node.then)
+			i.inspect(&region.Structure, node.otherwise)
+			structure.Conditions = append(structure.Conditions, region)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package docx_test
+
+import (
+	"docx"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart +
+			`<w:p><w:r><w:t>Dear «na</w:t></w:r><w:r><w:t>me»,</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«start:order»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Order «number»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«start:line»«article»«end:line»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«if:paid»paid«else:paid»«due»«endif:paid»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«end:order»</w:t></w:r></w:p>` +
+			testDocumentEnd,
+		"word/header1.xml": `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:p><w:r><w:t>Ref. «reference»</w:t></w:r></w:p></w:hdr>`,
+	})
+
+	s, err := r.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Placeholders) != 2 {
+		t.Fatalf("expected 2 top level placeholders, got %+v", s.Placeholders)
+	}
+	name := s.Placeholders[0]
+	if name.Name != "name" || name.Location.Part != "word/document.xml" || name.Location.Paragraph != 0 || name.Location.Text != "Dear «name»," {
+		t.Errorf("unexpected placeholder %+v", name)
+	}
+	reference := s.Placeholders[1]
+	if reference.Name != "reference" || reference.Location.Part != "word/header1.xml" || reference.Location.Paragraph != 0 {
+		t.Errorf("unexpected placeholder %+v", reference)
+	}
+
+	if len(s.Loops) != 1 || s.Loops[0].Name != "order" || s.Loops[0].Location.Paragraph != 1 {
+		t.Fatalf("unexpected loops %+v", s.Loops)
+	}
+	order := s.Loops[0]
+	if len(order.Placeholders) != 1 || order.Placeholders[0].Name != "number" || order.Placeholders[0].Location.Paragraph != 2 {
+		t.Errorf("unexpected loop placeholders %+v", order.Placeholders)
+	}
+	if len(order.Loops) != 1 || order.Loops[0].Name != "line" || order.Loops[0].Placeholders[0].Name != "article" {
+		t.Errorf("unexpected nested loops %+v", order.Loops)
+	}
+	if len(order.Conditions) != 1 || order.Conditions[0].Name != "paid" || order.Conditions[0].Placeholders[0].Name != "due" {
+		t.Errorf("unexpected conditions %+v", order.Conditions)
+	}
+}
+
+func TestPackagePartsAndRelationships(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>«name»</w:t></w:r></w:p>` + testDocumentEnd,
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="/word/styles.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com" TargetMode="External"/>` +
+			`</Relationships>`,
+	}).Editable()
+	if err := d.Render(map[string]interface{}{"name": "Arthur"}); err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := d.PackageParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]docx.PackagePart)
+	for _, p := range parts {
+		types[p.Name] = p
+	}
+	if p := types["word/document.xml"]; p.ContentType != "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml" || p.CompressedSize != 0 || p.Size == 0 {
+		t.Errorf("unexpected document part %+v", p)
+	}
+	if p := types["_rels/.rels"]; p.ContentType != "application/vnd.openxmlformats-package.relationships+xml" || p.CompressedSize == 0 {
+		t.Errorf("unexpected relationships part %+v", p)
+	}
+
+	rels, err := d.Relationships()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []docx.Relationship{
+		{Source: "", ID: "rId1", Type: "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument", Target: "word/document.xml"},
+		{Source: "word/document.xml", ID: "rId1", Type: "http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles", Target: "word/styles.xml"},
+		{Source: "word/document.xml", ID: "rId2", Type: "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink", Target: "https://example.com", External: true},
+	}
+	if !reflect.DeepEqual(rels, expected) {
+		t.Errorf("expected %+v, got %+v", expected, rels)
+	}
+}
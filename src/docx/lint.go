@@ -0,0 +1,122 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+	"xml"
+)
+
+// Warning is a problem of a template found by Lint.
+type Warning struct {
+	Location Location `json:"location"` // the paragraph is -1 for problems of a whole part
+	Message  string   `json:"message"`
+}
+
+// Lint checks the docx for problems that make a template misbehave:
+// placeholders that are split across several runs or not closed, regions
+// whose markers do not match, invalid formatters and relationships to
+// missing parts. Parts that cannot be parsed are reported as well, and the
+// other parts are still checked.
+func (d *Docx) Lint() []Warning {
+	var warnings []Warning
+	warn := func(location Location, message string) {
+		warnings = append(warnings, Warning{Location: location, Message: message})
+	}
+	for _, name := range d.PartNames() {
+		part := Location{Part: name, Paragraph: -1}
+		tokens, err := readTokens(d.part(name))
+		if err != nil {
+			warn(part, err.Error())
+			continue
+		}
+		for i, texts := range paragraphRuns(tokens) {
+			location := Location{Part: name, Paragraph: i, Text: strings.Join(texts, "")}
+			for _, message := range lintPlaceholders(texts) {
+				warn(location, message)
+			}
+		}
+
+		content, err := mergePlaceholderRuns(d.part(name))
+		if err == nil {
+			tokens, err = readTokens(content)
+		}
+		if err != nil {
+			warn(part, err.Error())
+			continue
+		}
+		nodes, err := parseTemplate(tokens)
+		if err != nil {
+			warn(part, err.Error())
+			continue
+		}
+		i := &inspector{part: name, texts: paragraphTexts(tokens)}
+		walkFields(nodes, func(f *field) {
+			if f.formatErr != nil {
+				warn(i.location(f), fmt.Sprintf("placeholder «%s»: %v", f.name, f.formatErr))
+			}
+		})
+	}
+
+	rels, err := d.Relationships()
+	if err != nil {
+		warn(Location{Paragraph: -1}, err.Error())
+	}
+	for _, rel := range rels {
+		if !rel.External && !d.hasFile(rel.Target) {
+			source := rel.Source
+			if source == "" {
+				source = "package"
+			}
+			warn(Location{Part: relationshipsPart(rel.Source), Paragraph: -1},
+				fmt.Sprintf("relationship %s of %s points to the missing part %s", rel.ID, source, rel.Target))
+		}
+	}
+	return warnings
+}
+
+// lintPlaceholders checks the placeholders of a paragraph, given as the texts of its runs.
+func lintPlaceholders(texts []string) []string {
+	var messages []string
+	var name strings.Builder
+	start := -1 // run of the placeholder that is open
+	for i, text := range texts {
+		for _, r := range text {
+			switch {
+			case string(r) == mergeFieldOpenTag:
+				if start >= 0 {
+					messages = append(messages, fmt.Sprintf("placeholder «%s is not closed", name.String()))
+				}
+				start = i
+				name.Reset()
+			case string(r) == mergeFieldCloseTag && start >= 0:
+				if runs := i - start + 1; runs > 1 {
+					messages = append(messages, fmt.Sprintf("placeholder «%s» is split across %d runs", name.String(), runs))
+				}
+				start = -1
+			case start >= 0:
+				name.WriteRune(r)
+			}
+		}
+	}
+	if start >= 0 {
+		messages = append(messages, fmt.Sprintf("placeholder «%s is not closed", name.String()))
+	}
+	return messages
+}
+
+// walkFields calls visit for all placeholders of a parsed template.
+func walkFields(nodes []xml.Token, visit func(f *field)) {
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *element:
+			walkFields(node.children, visit)
+		case *field:
+			visit(node)
+		case *loop:
+			walkFields(node.body, visit)
+		case *condition:
+			walkFields(node.then, visit)
+			walkFields(node.otherwise, visit)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package docx_test
+
+import (
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart +
+			`<w:p><w:r><w:t>Dear «na</w:t></w:r><w:r><w:t>me»,</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Total: «amount|number:»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«start:items»</w:t></w:r></w:p>` +
+			testDocumentEnd,
+		"word/header1.xml": `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:p><w:r><w:t>Ref. «reference</w:t></w:r></w:p></w:hdr>`,
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/header" Target="header1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>` +
+			`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image%202.png"/>` +
+			`</Relationships>`,
+		"word/media/image 2.png": "",
+		"word/footer1.xml":       `<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:p></w:ftr>`,
+	}).Editable()
+
+	warnings := d.Lint()
+	expected := []struct {
+		part      string
+		paragraph int
+		message   string
+	}{
+		{"word/document.xml", 0, "placeholder «name» is split across 2 runs"},
+		{"word/document.xml", -1, `region "items" is not closed`},
+		{"word/footer1.xml", -1, "XML syntax error on line 1: element <p> closed by </ftr>"},
+		{"word/header1.xml", 0, "placeholder «reference is not closed"},
+		{"word/_rels/document.xml.rels", -1, "relationship rId2 of word/document.xml points to the missing part word/media/image1.png"},
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %+v", len(expected), warnings)
+	}
+	for i, w := range warnings {
+		if w.Location.Part != expected[i].part || w.Location.Paragraph != expected[i].paragraph || w.Message != expected[i].message {
+			t.Errorf("expected %+v, got %+v", expected[i], w)
+		}
+	}
+}
+
+func TestLintFormat(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>Total: «amount|number:2|»</w:t></w:r></w:p>`)
+	warnings := d.Lint()
+	if len(warnings) != 1 || warnings[0].Location.Text != "Total: «amount|number:2|»" {
+		t.Errorf("expected a warning for the format, got %+v", warnings)
+	}
+}
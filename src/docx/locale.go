@@ -0,0 +1,308 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locale holds the conventions used by the date, number, currency and
+// ordinal formatters. The locales de-DE, en-US, en-GB and fr-FR are built in.
+type Locale struct {
+	// DecimalSeparator and GroupSeparator separate the decimals and the thousands.
+	DecimalSeparator, GroupSeparator string
+	// CurrencyFormat places the number (#) and the currency symbol (¤), e.g. "¤#".
+	CurrencyFormat string
+	// CurrencySymbols are the symbols by ISO 4217 code.
+	// Currencies without a symbol are written with their code.
+	CurrencySymbols map[string]string
+	// DateLayout is the Go layout used by the date formatter without argument.
+	DateLayout string
+	// Months, ShortMonths, Days and ShortDays replace the English names of
+	// the Go layouts "January", "Jan", "Monday" and "Mon". Days start with Sunday.
+	Months, ShortMonths [12]string
+	Days, ShortDays     [7]string
+	// Ordinal writes an ordinal number, e.g. "1st" or "1.".
+	Ordinal func(n int) string
+}
+
+var currencySymbols = map[string]string{"EUR": "€", "USD": "$", "GBP": "£", "JPY": "¥", "CHF": "CHF"}
+
+var englishMonths = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+var englishShortMonths = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+var englishDays = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+var englishShortDays = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+func englishOrdinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// defaultLocale is used if the render options do not name a locale.
+// It writes numbers without group separators and dates in ISO 8601 format.
+var defaultLocale = &Locale{
+	DecimalSeparator: ".",
+	CurrencyFormat:   "¤#",
+	CurrencySymbols:  currencySymbols,
+	DateLayout:       "2006-01-02",
+	Months:           englishMonths,
+	ShortMonths:      englishShortMonths,
+	Days:             englishDays,
+	ShortDays:        englishShortDays,
+	Ordinal:          englishOrdinal,
+}
+
+var locales = struct {
+	sync.RWMutex
+	byTag map[string]*Locale
+}{byTag: map[string]*Locale{
+	"de-DE": {
+		DecimalSeparator: ",",
+		GroupSeparator:   ".",
+		CurrencyFormat:   "#\u00a0¤",
+		CurrencySymbols:  currencySymbols,
+		DateLayout:       "02.01.2006",
+		Months:           [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths:      [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		Days:             [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortDays:        [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		Ordinal:          func(n int) string { return strconv.Itoa(n) + "." },
+	},
+	"en-US": {
+		DecimalSeparator: ".",
+		GroupSeparator:   ",",
+		CurrencyFormat:   "¤#",
+		CurrencySymbols:  currencySymbols,
+		DateLayout:       "01/02/2006",
+		Months:           englishMonths,
+		ShortMonths:      englishShortMonths,
+		Days:             englishDays,
+		ShortDays:        englishShortDays,
+		Ordinal:          englishOrdinal,
+	},
+	"en-GB": {
+		DecimalSeparator: ".",
+		GroupSeparator:   ",",
+		CurrencyFormat:   "¤#",
+		CurrencySymbols:  currencySymbols,
+		DateLayout:       "02/01/2006",
+		Months:           englishMonths,
+		ShortMonths:      englishShortMonths,
+		Days:             englishDays,
+		ShortDays:        englishShortDays,
+		Ordinal:          englishOrdinal,
+	},
+	"fr-FR": {
+		DecimalSeparator: ",",
+		GroupSeparator:   "\u202f",
+		CurrencyFormat:   "#\u00a0¤",
+		CurrencySymbols:  currencySymbols,
+		DateLayout:       "02/01/2006",
+		Months:           [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths:      [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:             [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortDays:        [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		Ordinal: func(n int) string {
+			if n == 1 {
+				return "1er"
+			}
+			return strconv.Itoa(n) + "e"
+		},
+	},
+}}
+
+// RegisterLocale adds a locale, or replaces one, under a tag like "de-CH".
+func RegisterLocale(tag string, locale *Locale) {
+	locales.Lock()
+	defer locales.Unlock()
+	locales.byTag[normalizeTag(tag)] = locale
+}
+
+// lookupLocale returns the locale with the given tag. A tag without region,
+// e.g. "de", selects the first locale of that language in alphabetical order.
+// The default locale is returned for an empty tag.
+func lookupLocale(tag string) (*Locale, error) {
+	if tag == "" {
+		return defaultLocale, nil
+	}
+	tag = normalizeTag(tag)
+	locales.RLock()
+	defer locales.RUnlock()
+	if locale, ok := locales.byTag[tag]; ok {
+		return locale, nil
+	}
+	match := ""
+	for t := range locales.byTag {
+		if strings.HasPrefix(t, tag+"-") && (match == "" || t < match) {
+			match = t
+		}
+	}
+	if match == "" {
+		return nil, fmt.Errorf("unknown locale %q", tag)
+	}
+	return locales.byTag[match], nil
+}
+
+// normalizeTag writes a language tag like "de_de" as "de-DE".
+func normalizeTag(tag string) string {
+	parts := strings.Split(strings.Replace(tag, "_", "-", -1), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i])
+	}
+	return strings.Join(parts, "-")
+}
+
+// formatNumber formats a number with the given number of decimals, 0 by default.
+func (l *Locale) formatNumber(value interface{}, args ...string) (interface{}, error) {
+	decimals, err := decimalsArgument(args)
+	if err != nil {
+		return nil, err
+	}
+	f, ok, err := numberValue(value)
+	if err != nil || !ok {
+		return "", err
+	}
+	return l.number(f, decimals), nil
+}
+
+// formatCurrency formats an amount in the currency given by its ISO 4217 code,
+// with 2 decimals unless the number of decimals is given as second argument,
+// e.g. «total|currency:EUR».
+func (l *Locale) formatCurrency(value interface{}, args ...string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected the currency code as argument")
+	}
+	decimals := 2
+	if len(args) > 1 {
+		var err error
+		if decimals, err = decimalsArgument(args[1:]); err != nil {
+			return nil, err
+		}
+	}
+	f, ok, err := numberValue(value)
+	if err != nil || !ok {
+		return "", err
+	}
+	symbol, ok := l.CurrencySymbols[strings.ToUpper(args[0])]
+	if !ok {
+		symbol = strings.ToUpper(args[0])
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	text := strings.Replace(l.CurrencyFormat, "#", l.number(f, decimals), 1)
+	return sign + strings.Replace(text, "¤", symbol, 1), nil
+}
+
+// number writes a number with separators.
+func (l *Locale) number(f float64, decimals int) string {
+	text := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	integer, fraction := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		integer, fraction = text[:i], text[i+1:]
+	}
+	if l.GroupSeparator != "" {
+		var groups []string
+		for len(integer) > 3 {
+			groups = append([]string{integer[len(integer)-3:]}, groups...)
+			integer = integer[:len(integer)-3]
+		}
+		integer = strings.Join(append([]string{integer}, groups...), l.GroupSeparator)
+	}
+	if f < 0 && strings.Trim(text, "0.") != "" {
+		integer = "-" + integer
+	}
+	if fraction == "" {
+		return integer
+	}
+	return integer + l.DecimalSeparator + fraction
+}
+
+// formatDate formats a time.Time with a Go layout, the date layout of the
+// locale by default. Month and day names are written in the language of the locale.
+// Strings in RFC 3339 format or like "2006-01-02" are parsed first.
+func (l *Locale) formatDate(value interface{}, args ...string) (interface{}, error) {
+	layout := l.DateLayout
+	if len(args) > 0 {
+		layout = args[0]
+	}
+	t, ok, err := timeValue(value)
+	if err != nil || !ok {
+		return "", err
+	}
+	// the names are replaced by control characters that Format keeps
+	names := []struct {
+		layout, mark, name string
+	}{
+		{"January", "\x01", l.Months[t.Month()-1]},
+		{"Monday", "\x02", l.Days[t.Weekday()]},
+		{"Jan", "\x03", l.ShortMonths[t.Month()-1]},
+		{"Mon", "\x04", l.ShortDays[t.Weekday()]},
+	}
+	for _, n := range names {
+		layout = strings.Replace(layout, n.layout, n.mark, -1)
+	}
+	text := t.Format(layout)
+	for _, n := range names {
+		text = strings.Replace(text, n.mark, n.name, -1)
+	}
+	return text, nil
+}
+
+// timeValue converts a value to a time. Nil values and zero times are not converted.
+func timeValue(value interface{}) (time.Time, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return v, !v.IsZero(), nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false, nil
+		}
+		return *v, !v.IsZero(), nil
+	case string:
+		if v == "" {
+			return time.Time{}, false, nil
+		}
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true, nil
+			}
+		}
+		return time.Time{}, false, fmt.Errorf("%q is not a date", v)
+	}
+	return time.Time{}, false, fmt.Errorf("%v is not a date", value)
+}
+
+// formatOrdinal writes a whole number as ordinal, e.g. «day|ordinal» as "1st".
+func (l *Locale) formatOrdinal(value interface{}, args ...string) (interface{}, error) {
+	f, ok, err := numberValue(value)
+	if err != nil || !ok {
+		return "", err
+	}
+	if f != math.Trunc(f) {
+		return nil, fmt.Errorf("%v is not a whole number", value)
+	}
+	if l.Ordinal == nil {
+		return strconv.Itoa(int(f)), nil
+	}
+	return l.Ordinal(int(f)), nil
+}
@@ -0,0 +1,53 @@
+package docx_test
+
+import (
+	"docx"
+	"testing"
+	"time"
+)
+
+const localeBody = `<w:p><w:r><w:t>«amount|number:2»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«amount|currency:EUR»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«date|date»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«date|date:"Monday, 2 January 2006"»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«day|ordinal»</w:t></w:r></w:p>`
+
+func TestLocales(t *testing.T) {
+	data := map[string]interface{}{
+		"amount": -1234567.5,
+		"date":   time.Date(2017, 3, 1, 8, 0, 0, 0, time.UTC),
+		"day":    2,
+	}
+	for _, test := range []struct {
+		locale   string
+		expected string
+	}{
+		{"", "-1234567.50|-€1234567.50|2017-03-01|Wednesday, 1 March 2017|2nd"},
+		{"de-DE", "-1.234.567,50|-1.234.567,50\u00a0€|01.03.2017|Mittwoch, 1 März 2017|2."},
+		{"en-US", "-1,234,567.50|-€1,234,567.50|03/01/2017|Wednesday, 1 March 2017|2nd"},
+		{"fr_fr", "-1\u202f234\u202f567,50|-1\u202f234\u202f567,50\u00a0€|01/03/2017|mercredi, 1 mars 2017|2e"},
+		{"en", "-1,234,567.50|-€1,234,567.50|01/03/2017|Wednesday, 1 March 2017|2nd"},
+	} {
+		d := newTestDocx(t, localeBody)
+		if err := d.RenderWithOptions(data, docx.RenderOptions{Locale: test.locale}); err != nil {
+			t.Fatal(err)
+		}
+		if actual := texts(d.Content); actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.locale, test.expected, actual)
+		}
+	}
+}
+
+func TestRegisterLocale(t *testing.T) {
+	docx.RegisterLocale("de-CH", &docx.Locale{DecimalSeparator: ".", GroupSeparator: "’", CurrencyFormat: "¤ #", DateLayout: "02.01.2006"})
+	d := newTestDocx(t, `<w:p><w:r><w:t>«amount|currency:CHF»</w:t></w:r></w:p>`)
+	if err := d.RenderWithOptions(map[string]float64{"amount": 1234.5}, docx.RenderOptions{Locale: "de-CH"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "CHF 1’234.50", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if err := d.RenderWithOptions(nil, docx.RenderOptions{Locale: "xx-XX"}); err == nil {
+		t.Error("expected an error for an unknown locale")
+	}
+}
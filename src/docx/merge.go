@@ -0,0 +1,381 @@
+package docx
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"xml"
+)
+
+const (
+	relationshipHeader = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/header"
+	relationshipFooter = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/footer"
+	headerContentType  = "application/vnd.openxmlformats-officedocument.wordprocessingml.header+xml"
+	footerContentType  = "application/vnd.openxmlformats-officedocument.wordprocessingml.footer+xml"
+)
+
+// MergeBreak separates the records of a merged document.
+type MergeBreak int
+
+const (
+	// SectionBreak starts a section for each record. The headers and
+	// footers of each section are rendered with the data of its record.
+	// If the body of the template has no section properties, the records
+	// are separated by page breaks instead.
+	SectionBreak MergeBreak = iota
+	// PageBreak starts a page for each record. The document has a single
+	// section, whose headers and footers are rendered with the first record.
+	PageBreak
+)
+
+// MergeFunc receives the docx rendered for a record, numbered from 1.
+type MergeFunc func(number int, record interface{}, d *Docx) error
+
+// Merge renders the template once for each record and passes the docx to
+// write. The records may be a slice, an array, a channel or an iterator
+// function like iter.Seq. The merge stops at the first error.
+func (t *Template) Merge(ctx context.Context, records interface{}, write MergeFunc) error {
+	return t.merge(ctx, records, func(record interface{}, position *loopPosition, d *Docx) error {
+		return write(position.index+1, record, d)
+	})
+}
+
+// MergeToDir writes a docx for each record to the directory dir. The file
+// name may hold placeholders that are rendered with the record,
+// e.g. "letter-«#number».docx" or "«customer.id».docx".
+func (t *Template) MergeToDir(ctx context.Context, records interface{}, dir, name string) error {
+	names := make(map[string]bool)
+	return t.merge(ctx, records, func(record interface{}, position *loopPosition, d *Docx) error {
+		fileName, err := t.mergeFileName(name, record, position, names)
+		if err != nil {
+			return err
+		}
+		if fileName != filepath.Base(fileName) || fileName == ".." {
+			return fmt.Errorf("file name %q is not in the directory", fileName)
+		}
+		return d.WriteToFile(filepath.Join(dir, fileName))
+	})
+}
+
+// MergeToZip writes a zip archive holding a docx for each record. The file
+// names are rendered like those of MergeToDir and may contain folders, but
+// no ".." elements.
+func (t *Template) MergeToZip(ctx context.Context, records interface{}, w io.Writer, name string) error {
+	archive := zip.NewWriter(w)
+	names := make(map[string]bool)
+	err := t.merge(ctx, records, func(record interface{}, position *loopPosition, d *Docx) error {
+		fileName, err := t.mergeFileName(name, record, position, names)
+		if err != nil {
+			return err
+		}
+		if !isLocalName(fileName) {
+			return fmt.Errorf("file name %q is not in the archive", fileName)
+		}
+		// the docx is compressed already
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: fileName, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		return d.Write(writer)
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// isLocalName reports whether a slash-separated name stays within the
+// folder it is relative to: it is not absolute, has no ".." elements, and
+// no backslashes or colons, which start paths and drives on Windows.
+func isLocalName(name string) bool {
+	if path.IsAbs(name) || strings.Contains(name, `\`) || strings.Contains(name, ":") {
+		return false
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// merge renders the template for each record.
+func (t *Template) merge(ctx context.Context, records interface{}, write func(record interface{}, position *loopPosition, d *Docx) error) error {
+	items, ok := elements(records)
+	if !ok {
+		return errors.New("the records are not a collection")
+	}
+	var err error
+	items.each(func(record interface{}, position *loopPosition) bool {
+		var d *Docx
+		if d, err = t.Render(ctx, record); err == nil {
+			err = write(record, position, d)
+		}
+		if err != nil {
+			err = fmt.Errorf("record %d: %v", position.index+1, err)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// mergeFileName renders the file name of a record, which must be unique.
+func (t *Template) mergeFileName(name string, record interface{}, position *loopPosition, names map[string]bool) (string, error) {
+	r := t.newRenderer(context.Background(), nil)
+	fileName, _ := r.renderText(name, &scope{data: record, loop: position})
+	if r.err != nil {
+		return "", r.err
+	}
+	if fileName == "" || names[fileName] {
+		return "", fmt.Errorf("file name %q is not unique", fileName)
+	}
+	names[fileName] = true
+	return fileName, nil
+}
+
+// MergeDocument renders the body of the main document once for each record
+// into a single docx, separated by section or page breaks. The records may
+// be a slice, an array, a channel or an iterator function like iter.Seq.
+// Within the body, «#number», «#first» etc. give the position of the record.
+// The other story parts, like footnotes, and the document properties are
+// rendered with the first record.
+// The Strict option is not supported for channels and iterators, because
+// their records can only be received once.
+func (t *Template) MergeDocument(ctx context.Context, records interface{}, separator MergeBreak) (*Docx, error) {
+	if t.options.Strict && isStream(records) {
+		return nil, errors.New("strict rendering is not supported for records from a channel or an iterator")
+	}
+	nodes, ok := t.templates[documentPart]
+	if !ok {
+		return nil, fmt.Errorf("part %q is not rendered by the template", documentPart)
+	}
+	body := documentBody(nodes)
+	if body == nil {
+		return nil, fmt.Errorf("%s: no body found", documentPart)
+	}
+	content, section := body.children, []xml.Token(nil)
+	for i := len(content) - 1; i >= 0; i-- {
+		if el, ok := content[i].(*element); ok {
+			if el.is("sectPr") {
+				content, section = content[:i], content[i:i+1]
+			}
+			break
+		}
+	}
+	items, ok := elements(records)
+	if !ok {
+		return nil, errors.New("the records are not a collection")
+	}
+
+	d := t.newDocx()
+	r := t.newRenderer(ctx, d)
+	m := &merger{template: t, renderer: r, sections: make(map[string]relationship)}
+	rels, err := d.readRelationships(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rels.Relationship {
+		if rel.Type == relationshipHeader || rel.Type == relationshipFooter {
+			m.sections[rel.ID] = rel
+		}
+	}
+
+	var merged []xml.Token
+	var first *scope // scope of the first record
+	items.each(func(record interface{}, position *loopPosition) bool {
+		if r.canceled() {
+			return false
+		}
+		s := &scope{data: record, loop: position}
+		if position.index == 0 {
+			first = s
+		}
+		start := len(merged)
+		r.part = documentPart
+		merged = append(merged, r.render(content, s)...)
+		switch {
+		case position.last:
+			merged = append(merged, rawNodes(section)...)
+		case separator == PageBreak || section == nil:
+			run := newWordElement("r")
+			run.children = []xml.Token{newWordElement("br", xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "type"}, Value: "page"})}
+			merged = append(merged, newParagraph(run))
+		default:
+			props := newWordElement("pPr")
+			props.children = rawNodes(section)
+			merged = append(merged, newParagraph(props))
+		}
+		// the sections of the first record keep the headers and footers of the template
+		if separator == SectionBreak && section != nil && position.index > 0 {
+			m.references = make(map[string]string)
+			err = m.renderSections(merged[start:], s)
+		}
+		return err == nil && r.err == nil
+	})
+	if err == nil {
+		err = r.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, errors.New("no records to merge")
+	}
+	if d.Content, err = encodeString(withBody(nodes, merged)); err != nil {
+		return nil, err
+	}
+
+	for _, name := range t.names {
+		if name == documentPart {
+			continue
+		}
+		r.part = name
+		content, err := r.renderPart(t.templates[name], first)
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		d.setPart(name, content)
+	}
+	if len(t.options.Parts) == 0 {
+		r.part = ""
+		properties, err := r.renderProperties(first.data)
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			return nil, err
+		}
+		for name, content := range properties {
+			d.setFile(name, content)
+		}
+	}
+	if t.options.Strict {
+		if err := r.check(records); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// newParagraph returns a paragraph with the given children.
+func newParagraph(children ...xml.Token) *element {
+	p := newWordElement("p")
+	p.children = children
+	return p
+}
+
+// documentBody returns the body of a parsed main document.
+func documentBody(nodes []xml.Token) *element {
+	for _, n := range nodes {
+		if el, ok := n.(*element); ok && el.is("document") {
+			return el.child("body")
+		}
+	}
+	return nil
+}
+
+// withBody returns a copy of a parsed main document with the given body content.
+func withBody(nodes []xml.Token, content []xml.Token) []xml.Token {
+	var result []xml.Token
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		switch {
+		case ok && el.is("body"):
+			result = append(result, &element{StartElement: el.StartElement.Copy(), children: content})
+		case ok && el.is("document"):
+			result = append(result, &element{StartElement: el.StartElement.Copy(), children: withBody(el.children, content)})
+		default:
+			result = append(result, rawNodes([]xml.Token{n})...)
+		}
+	}
+	return result
+}
+
+// merger renders copies of the headers and footers for the sections of a record.
+type merger struct {
+	template   *Template
+	renderer   *renderer
+	sections   map[string]relationship // relationships of the main document to headers and footers by id
+	references map[string]string       // ids of the copies for the current record by the id of the template
+}
+
+// renderSections points the section properties within nodes to copies of
+// the headers and footers, which are rendered within the given scope.
+func (m *merger) renderSections(nodes []xml.Token, s *scope) error {
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			continue
+		}
+		if !el.is("headerReference") && !el.is("footerReference") {
+			if err := m.renderSections(el.children, s); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, attr := range el.Attr {
+			if attr.Name.Space != relationshipsNS || attr.Name.Local != "id" {
+				continue
+			}
+			id, err := m.reference(attr.Value, s)
+			if err != nil {
+				return err
+			}
+			el.Attr[i].Value = id
+		}
+	}
+	return nil
+}
+
+// reference returns the id of the relationship to the copy of a header or
+// footer, which is added when it is referenced for the first time.
+func (m *merger) reference(id string, s *scope) (string, error) {
+	if copyID, ok := m.references[id]; ok {
+		return copyID, nil
+	}
+	rel, ok := m.sections[id]
+	name := path.Join(path.Dir(documentPart), rel.Target)
+	content, isPart := m.template.parts[name]
+	if !ok || !isPart {
+		return id, nil
+	}
+	d, r := m.renderer.docx, m.renderer
+	prefix, contentType := "word/header", headerContentType
+	if rel.Type == relationshipFooter {
+		prefix, contentType = "word/footer", footerContentType
+	}
+	copyName := d.newPartName(prefix, ".xml")
+	rels, ok, err := d.readFile(relationshipsPart(name))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		d.setFile(relationshipsPart(copyName), rels)
+	}
+	if nodes, ok := m.template.templates[name]; ok {
+		r.part = copyName
+		content, err = encodeString(r.render(nodes, s))
+		r.part = documentPart
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	d.Parts[copyName] = content
+	if err := d.addOverrideContentType("/"+copyName, contentType); err != nil {
+		return "", err
+	}
+	copyID, err := d.addRelationship(documentPart, rel.Type, strings.TrimPrefix(copyName, "word/"), false)
+	if err != nil {
+		return "", err
+	}
+	m.references[id] = copyID
+	return copyID, nil
+}
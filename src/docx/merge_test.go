@@ -0,0 +1,171 @@
+package docx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"docx"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var mergeRecords = []map[string]string{{"name": "Arthur"}, {"name": "Ford"}, {"name": "Trillian"}}
+
+// newMergeTemplate returns a template with a letter body and a header.
+func newMergeTemplate(t *testing.T) *docx.Template {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>Dear «name»,</w:t></w:r></w:p>` +
+			`<w:sectPr><w:headerReference w:type="default" r:id="rId1"/><w:pgSz w:w="11906" w:h="16838"/></w:sectPr>` + testDocumentEnd,
+		"word/header1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:p><w:r><w:t>Letter «#number» to «name»</w:t></w:r></w:p></w:hdr>`,
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/header" Target="header1.xml"/>` +
+			`</Relationships>`,
+	})
+	template, err := docx.NewTemplate(r, docx.RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func TestMergeToZip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newMergeTemplate(t).MergeToZip(context.Background(), mergeRecords, &buf, "«#number»-«name».docx"); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 3 || archive.File[1].Name != "2-Ford.docx" {
+		t.Fatalf("expected a docx for each record, got %v", archive.File)
+	}
+	f, err := archive.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := docx.ReadDocxFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if expected, actual := "Dear |Ford|,", texts(r.Editable().Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	if err := newMergeTemplate(t).MergeToZip(context.Background(), mergeRecords, &buf, "letter.docx"); err == nil || !strings.Contains(err.Error(), "not unique") {
+		t.Errorf("expected an error for duplicate file names, got %v", err)
+	}
+	for _, name := range []string{"../«name».docx", "letters/../../«name».docx", "/tmp/«name».docx", `..\«name».docx`} {
+		if err := newMergeTemplate(t).MergeToZip(context.Background(), mergeRecords, &buf, name); err == nil || !strings.Contains(err.Error(), "not in the archive") {
+			t.Errorf("%s: expected an error for a file outside of the archive, got %v", name, err)
+		}
+	}
+	records := []map[string]string{{"name": "../../evil"}}
+	if err := newMergeTemplate(t).MergeToZip(context.Background(), records, &buf, "letters/«name».docx"); err == nil {
+		t.Error("expected an error for a record that leaves the archive")
+	}
+}
+
+func TestMergeToDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := newMergeTemplate(t).MergeToDir(context.Background(), mergeRecords, dir, "«name».docx"); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range mergeRecords {
+		if _, err := os.Stat(filepath.Join(dir, record["name"]+".docx")); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := newMergeTemplate(t).MergeToDir(context.Background(), mergeRecords, dir, "../«name».docx"); err == nil {
+		t.Error("expected an error for a file outside of the directory")
+	}
+}
+
+func TestMergeDocument(t *testing.T) {
+	d, err := newMergeTemplate(t).MergeDocument(context.Background(), mergeRecords, docx.SectionBreak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Dear |Arthur|,|Dear |Ford|,|Dear |Trillian|,", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if strings.Count(d.Content, "<w:sectPr>") != 3 || strings.Count(d.Content, "<w:pPr><w:sectPr>") != 2 {
+		t.Errorf("expected a section for each record, got %s", d.Content)
+	}
+	for _, id := range []string{"rId1", "rId2", "rId3"} {
+		if !strings.Contains(d.Content, `r:id="`+id+`"`) {
+			t.Errorf("expected a reference to the header %s, got %s", id, d.Content)
+		}
+	}
+
+	files := writtenFiles(t, d)
+	for name, expected := range map[string]string{
+		"word/header1.xml": "Letter |1| to |Arthur",
+		"word/header2.xml": "Letter |2| to |Ford",
+		"word/header3.xml": "Letter |3| to |Trillian",
+	} {
+		if actual := texts(files[name]); actual != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, actual)
+		}
+	}
+	if !strings.Contains(files["word/_rels/document.xml.rels"], `Target="header3.xml"`) {
+		t.Errorf("expected a relationship to the copied header, got %s", files["word/_rels/document.xml.rels"])
+	}
+	if !strings.Contains(files["[Content_Types].xml"], `PartName="/word/header2.xml"`) {
+		t.Errorf("expected a content type for the copied header, got %s", files["[Content_Types].xml"])
+	}
+}
+
+func TestMergeDocumentPageBreak(t *testing.T) {
+	d, err := newMergeTemplate(t).MergeDocument(context.Background(), mergeRecords, docx.PageBreak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(d.Content, `<w:br w:type="page">`) != 2 || strings.Count(d.Content, "<w:sectPr>") != 1 {
+		t.Errorf("expected page breaks between the records, got %s", d.Content)
+	}
+	if actual := texts(writtenFiles(t, d)["word/header1.xml"]); actual != "Letter |1| to |Arthur" {
+		t.Errorf("expected the header of the first record, got %q", actual)
+	}
+	if _, err := newMergeTemplate(t).MergeDocument(context.Background(), nil, docx.PageBreak); err == nil {
+		t.Error("expected an error without records")
+	}
+}
+
+func TestMergeDocumentWithoutSection(t *testing.T) {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>Dear «name»,</w:t></w:r></w:p>` + testDocumentEnd,
+	})
+	template, err := docx.NewTemplate(r, docx.RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := template.MergeDocument(context.Background(), mergeRecords, docx.SectionBreak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(d.Content, `<w:br w:type="page">`) != 2 {
+		t.Errorf("expected page breaks between the records, got %s", d.Content)
+	}
+}
+
+func TestMergeDocumentStrictStream(t *testing.T) {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>Dear «name»,</w:t></w:r></w:p>` + testDocumentEnd,
+	})
+	template, err := docx.NewTemplate(r, docx.RenderOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(chan map[string]string)
+	close(records)
+	if _, err := template.MergeDocument(context.Background(), (<-chan map[string]string)(records), docx.PageBreak); err == nil || !strings.Contains(err.Error(), "strict") {
+		t.Errorf("expected an error for strict rendering of a channel, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package docx
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"xml"
+)
+
+const mergeFieldInstruction = "MERGEFIELD"
+
+// mergeFieldRegions maps the region prefixes of mail merge templates to the markers of this package.
+var mergeFieldRegions = [][2]string{
+	{"TableStart:", loopStartPrefix},
+	{"TableEnd:", loopEndPrefix},
+	{"BeginGroup:", loopStartPrefix},
+	{"EndGroup:", loopEndPrefix},
+}
+
+// convertMergeFields replaces the MERGEFIELD fields of Word's mail merge by
+// *field values, both simple fields (<w:fldSimple>) and complex fields
+// (<w:fldChar> begin, instruction, separate, result, end) within a paragraph.
+// The field name may also be a loop or condition marker, and the regions of
+// mail merge templates, «TableStart:name» and «TableEnd:name», become loops.
+func convertMergeFields(nodes []xml.Token) []xml.Token {
+	c := &mergeFieldConverter{}
+	return c.convert(nodes, -1)
+}
+
+type mergeFieldConverter struct {
+	paragraphs int // number of paragraphs seen so far
+}
+
+func (c *mergeFieldConverter) convert(nodes []xml.Token, paragraph int) []xml.Token {
+	var result []xml.Token
+	for i := 0; i < len(nodes); i++ {
+		switch node := nodes[i].(type) {
+		case *field:
+			node.paragraph = paragraph
+		case *element:
+			if node.is("fldSimple") {
+				if f := newMergeField(attrValue(node.StartElement, "instr"), node.children); f != nil {
+					f.paragraph = paragraph
+					f.original = []xml.Token{node}
+					result = append(result, f)
+					continue
+				}
+			}
+			if fieldChar(node) == "begin" {
+				if end, instruction, content, ok := complexField(nodes, i); ok {
+					if f := newMergeField(instruction, content); f != nil {
+						f.paragraph = paragraph
+						f.original = nodes[i : end+1]
+						result = append(result, f)
+						i = end
+						continue
+					}
+				}
+			}
+			inner := paragraph
+			if node.is("p") {
+				inner = c.paragraphs
+				c.paragraphs++
+			}
+			node.children = c.convert(node.children, inner)
+		}
+		result = append(result, nodes[i])
+	}
+	return result
+}
+
+// fieldChar returns the type of the <w:fldChar> of a run, e.g. "begin".
+func fieldChar(run *element) string {
+	if !run.is("r") {
+		return ""
+	}
+	if char := run.child("fldChar"); char != nil {
+		return attrValue(char.StartElement, "fldCharType")
+	}
+	return ""
+}
+
+// complexField returns the index of the run ending the complex field that
+// begins at nodes[begin], its instruction and the runs of its result.
+func complexField(nodes []xml.Token, begin int) (int, string, []xml.Token, bool) {
+	var instruction strings.Builder
+	var content []xml.Token
+	depth, separated := 0, false
+	for i := begin; i < len(nodes); i++ {
+		var run *element
+		switch node := nodes[i].(type) {
+		case *element:
+			run = node
+		case *field:
+			run = node.run
+		}
+		if run == nil {
+			continue
+		}
+		switch fieldChar(run) {
+		case "begin":
+			depth++
+			continue
+		case "separate":
+			if depth == 1 {
+				separated = true
+				continue
+			}
+		case "end":
+			depth--
+			if depth == 0 {
+				return i, instruction.String(), content, true
+			}
+			continue
+		}
+		if depth != 1 {
+			continue
+		}
+		if separated {
+			content = append(content, nodes[i])
+		} else if text := run.child("instrText"); text != nil {
+			for _, c := range text.children {
+				if data, ok := c.(xml.CharData); ok {
+					instruction.Write(data)
+				}
+			}
+		}
+	}
+	return 0, "", nil, false
+}
+
+// newMergeField creates the field of a MERGEFIELD instruction like
+// ` MERGEFIELD name \* Upper \b "Dear " `. It returns nil for other fields.
+// The placeholder takes the format of the first run of the result.
+func newMergeField(instruction string, content []xml.Token) *field {
+	args := splitInstruction(instruction)
+	if len(args) < 2 || !strings.EqualFold(args[0], mergeFieldInstruction) {
+		return nil
+	}
+	f := &field{name: args[1]}
+	for _, region := range mergeFieldRegions {
+		if len(f.name) > len(region[0]) && strings.EqualFold(f.name[:len(region[0])], region[0]) {
+			f.name = region[1] + f.name[len(region[0]):]
+		}
+	}
+
+	var before, after string
+	for i := 2; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], `\`) || i+1 >= len(args) {
+			continue
+		}
+		switch strings.ToLower(args[i]) {
+		case `\*`:
+			switch strings.ToLower(args[i+1]) {
+			case "upper":
+				f.format = append(f.format, formatCall{name: "upper"})
+			case "lower":
+				f.format = append(f.format, formatCall{name: "lower"})
+			case "caps":
+				f.format = append(f.format, formatCall{name: "title"})
+			}
+		case `\@`:
+			f.format = append(f.format, formatCall{name: "date", args: []string{wordDateLayout(args[i+1])}})
+		case `\#`:
+			f.format = append(f.format, formatCall{name: "number", args: []string{wordDecimals(args[i+1])}})
+		case `\b`:
+			before = args[i+1]
+		case `\f`:
+			after = args[i+1]
+		default:
+			continue
+		}
+		i++
+	}
+	if before != "" {
+		f.format = append(f.format, formatCall{name: "prefix", args: []string{before}})
+	}
+	if after != "" {
+		f.format = append(f.format, formatCall{name: "suffix", args: []string{after}})
+	}
+
+	run := newWordElement("r")
+	for _, c := range content {
+		var first *element
+		switch node := c.(type) {
+		case *element:
+			first = node
+		case *field:
+			first = node.run
+		}
+		if first != nil && first.is("r") {
+			if props := first.child("rPr"); props != nil {
+				run.children = append(run.children, props.copy())
+			}
+			break
+		}
+	}
+	f.run = run
+	run.children = append(run.children, newTextElement(mergeFieldOpenTag+f.name+mergeFieldCloseTag))
+	return f
+}
+
+// splitInstruction splits a field instruction into words. Quoted words may contain spaces.
+func splitInstruction(instruction string) []string {
+	var words []string
+	var word strings.Builder
+	quoted, inWord := false, false
+	for _, c := range instruction {
+		switch {
+		case c == '"' || c == '“' || c == '”':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(c) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			inWord = false
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// wordDateLayout converts a Word date picture like "dd.MM.yyyy" to a Go layout.
+// Text in single quotes is kept as it is.
+func wordDateLayout(picture string) string {
+	replacements := [][2]string{
+		{"AM/PM", "PM"}, {"am/pm", "pm"},
+		{"yyyy", "2006"}, {"yy", "06"},
+		{"MMMM", "January"}, {"MMM", "Jan"}, {"MM", "01"}, {"M", "1"},
+		{"dddd", "Monday"}, {"ddd", "Mon"}, {"dd", "02"}, {"d", "2"},
+		{"HH", "15"}, {"H", "15"}, {"hh", "03"}, {"h", "3"},
+		{"mm", "04"}, {"m", "4"}, {"ss", "05"}, {"s", "5"},
+	}
+	var layout strings.Builder
+next:
+	for i := 0; i < len(picture); {
+		if picture[i] == '\'' {
+			end := strings.IndexByte(picture[i+1:], '\'')
+			if end < 0 {
+				end = len(picture) - i - 1
+			}
+			layout.WriteString(picture[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+		for _, r := range replacements {
+			if strings.HasPrefix(picture[i:], r[0]) {
+				layout.WriteString(r[1])
+				i += len(r[0])
+				continue next
+			}
+		}
+		layout.WriteByte(picture[i])
+		i++
+	}
+	return layout.String()
+}
+
+// wordDecimals returns the number of decimals of a Word number picture like "#,##0.00".
+func wordDecimals(picture string) string {
+	decimals := 0
+	if i := strings.LastIndex(picture, "."); i >= 0 {
+		decimals = strings.Count(picture[i+1:], "0") + strings.Count(picture[i+1:], "#")
+	}
+	return strconv.Itoa(decimals)
+}
+
+// attrValue returns the value of an attribute in the WordprocessingML namespace.
+func attrValue(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == wordNamespace && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package docx_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// complexField returns the runs of a complex field with the given instruction and result.
+func complexField(instruction, result string) string {
+	return `<w:r><w:fldChar w:fldCharType="begin"/></w:r>` +
+		`<w:r><w:instrText xml:space="preserve">` + instruction + `</w:instrText></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="separate"/></w:r>` +
+		`<w:r><w:rPr><w:b/></w:rPr><w:t>` + result + `</w:t></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="end"/></w:r>`
+}
+
+func TestSimpleMergeField(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t xml:space="preserve">Hello </w:t></w:r>`+
+		`<w:fldSimple w:instr=" MERGEFIELD name \* MERGEFORMAT "><w:r><w:t>«name»</w:t></w:r></w:fldSimple></w:p>`)
+	if err := d.Render(map[string]string{"name": "Arthur"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Hello |Arthur", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if strings.Contains(d.Content, "fldSimple") {
+		t.Errorf("expected the field to be replaced, got %s", d.Content)
+	}
+}
+
+func TestComplexMergeField(t *testing.T) {
+	d := newTestDocx(t, `<w:p>`+complexField(` MERGEFIELD  name \* Upper \b "Dear " \f "," `, "«name»")+`</w:p>`+
+		`<w:p>`+complexField(` MERGEFIELD title \b "Dear " `, "«title»")+`</w:p>`)
+	if err := d.Render(map[string]string{"name": "Arthur", "title": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Dear ARTHUR,|", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if strings.Contains(d.Content, "fldChar") || !strings.Contains(d.Content, "<w:b>") {
+		t.Errorf("expected the field to be replaced by a run with its format, got %s", d.Content)
+	}
+}
+
+func TestMergeFieldRegions(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl>`+
+		`<w:tr><w:tc><w:p>`+complexField(" MERGEFIELD TableStart:orders ", "«TableStart:orders»")+
+		complexField(" MERGEFIELD number ", "«number»")+`</w:p></w:tc>`+
+		`<w:tc><w:p><w:fldSimple w:instr=" MERGEFIELD total \# &quot;#,##0.00&quot; "><w:r><w:t>«total»</w:t></w:r></w:fldSimple>`+
+		complexField(" MERGEFIELD TableEnd:orders ", "«TableEnd:orders»")+`</w:p></w:tc></w:tr>`+
+		`</w:tbl>`)
+	data := map[string]interface{}{"orders": []map[string]interface{}{
+		{"number": "A1", "total": 42},
+		{"number": "B2", "total": 7.5},
+	}}
+	if err := d.Render(data); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "A1|42.00|B2|7.50", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if rows := strings.Count(d.Content, "<w:tr>"); rows != 2 {
+		t.Errorf("expected 2 rows, got %d", rows)
+	}
+}
+
+func TestMergeFieldWithoutData(t *testing.T) {
+	d := newTestDocx(t, `<w:p>`+complexField(" MERGEFIELD name ", "«name»")+`</w:p>`)
+	if err := d.Render(map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "«name»", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if strings.Count(d.Content, "<w:fldChar") != 3 || !strings.Contains(d.Content, " MERGEFIELD name </w:instrText>") {
+		t.Errorf("expected the field to be kept, got %s", d.Content)
+	}
+}
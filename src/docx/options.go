@@ -0,0 +1,75 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingMode determines how placeholders without data are rendered.
+type MissingMode int
+
+const (
+	// KeepMissing keeps the «placeholder» text.
+	KeepMissing MissingMode = iota
+	// BlankMissing removes the placeholder. Loops without data are
+	// removed together with their content, conditions without data
+	// render their else branch.
+	BlankMissing
+	// HighlightMissing keeps the «placeholder» text and highlights it.
+	HighlightMissing
+)
+
+// RenderOptions control how a template is rendered.
+type RenderOptions struct {
+	// Strict makes the render fail with a *RenderError if a placeholder,
+	// a loop or a condition has no data or if some data is not used.
+	Strict bool
+	// Missing determines how placeholders without data are rendered
+	// if the render is not strict.
+	Missing MissingMode
+	// HighlightColor is the highlight color used by HighlightMissing.
+	// It defaults to "yellow".
+	HighlightColor string
+	// Parts selects the story parts that are rendered, e.g. "word/header1.xml".
+	// All story parts and the placeholders in the document properties
+	// are rendered if it is empty.
+	Parts []string
+	// Locale selects the conventions of the date, number, currency and
+	// ordinal formatters, e.g. "de-DE". See Locale and RegisterLocale.
+	Locale string
+	// Formatters adds formatters for this render, e.g. «price|currency».
+	// They take precedence over the formatters added with RegisterFormatter.
+	Formatters map[string]Formatter
+}
+
+// RenderError is returned by strict renders if template and data do not match.
+type RenderError struct {
+	// MissingPlaceholders lists the placeholders without data.
+	// Placeholders inside loops are prefixed with the loop name, e.g. "topic.name".
+	MissingPlaceholders []string
+	// MissingLoops lists the loops without data.
+	MissingLoops []string
+	// MissingConditions lists the conditions without data.
+	MissingConditions []string
+	// UnusedData lists the data keys that are not used by the template.
+	UnusedData []string
+}
+
+func (e *RenderError) Error() string {
+	var problems []string
+	add := func(what string, names []string) {
+		if len(names) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", what, strings.Join(names, ", ")))
+		}
+	}
+	add("placeholders without data", e.MissingPlaceholders)
+	add("loops without data", e.MissingLoops)
+	add("conditions without data", e.MissingConditions)
+	add("unused data", e.UnusedData)
+	return "template and data do not match (" + strings.Join(problems, "; ") + ")"
+}
+
+func (e *RenderError) empty() bool {
+	return len(e.MissingPlaceholders) == 0 && len(e.MissingLoops) == 0 &&
+		len(e.MissingConditions) == 0 && len(e.UnusedData) == 0
+}
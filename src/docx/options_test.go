@@ -0,0 +1,90 @@
+package docx_test
+
+import (
+	"docx"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const optionsBody = `<w:p><w:r><w:t>«name» «title»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«start:topic»</w:t></w:r><w:r><w:t>«subject» «room»</w:t></w:r><w:r><w:t>«end:topic»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«start:guest»</w:t></w:r><w:r><w:t>«end:guest»</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>«if:vip»</w:t></w:r><w:r><w:t>VIP</w:t></w:r><w:r><w:t>«endif:vip»</w:t></w:r></w:p>`
+
+var optionsData = map[string]interface{}{
+	"name":  "Arthur",
+	"extra": "unused",
+	"topic": []map[string]string{{"subject": "Towels", "speaker": "Ford"}},
+}
+
+func TestRenderStrict(t *testing.T) {
+	d := newTestDocx(t, optionsBody)
+	before := d.Content
+	err := d.RenderWithOptions(optionsData, docx.RenderOptions{Strict: true})
+	renderErr, ok := err.(*docx.RenderError)
+	if !ok {
+		t.Fatalf("expected a *RenderError, got %v", err)
+	}
+	expected := &docx.RenderError{
+		MissingPlaceholders: []string{"title", "topic.room"},
+		MissingLoops:        []string{"guest"},
+		MissingConditions:   []string{"vip"},
+		UnusedData:          []string{"extra", "topic.speaker"},
+	}
+	if !reflect.DeepEqual(renderErr, expected) {
+		t.Errorf("expected %+v, got %+v", expected, renderErr)
+	}
+	if !strings.Contains(err.Error(), "topic.room") {
+		t.Errorf("expected the error message to list the missing placeholders, got %q", err.Error())
+	}
+	if strings.Replace(texts(d.Content), "|", "", -1) != strings.Replace(texts(before), "|", "", -1) {
+		t.Errorf("expected a failed render not to change the content, got %s", d.Content)
+	}
+}
+
+func TestRenderStrictObjects(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«logo»</w:t></w:r></w:p><w:p><w:r><w:t>«link»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«signed»</w:t></w:r></w:p>`)
+	data := map[string]interface{}{
+		"logo":   &docx.Image{Data: newTestPNG(t, 10, 10)},
+		"link":   docx.Hyperlink{URL: "https://example.com"},
+		"signed": time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := d.RenderWithOptions(data, docx.RenderOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderMissingModes(t *testing.T) {
+	d := newTestDocx(t, optionsBody)
+	if err := d.RenderWithOptions(optionsData, docx.RenderOptions{Missing: docx.BlankMissing}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Arthur| |Towels| ", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	d = newTestDocx(t, optionsBody)
+	if err := d.RenderWithOptions(optionsData, docx.RenderOptions{Missing: docx.HighlightMissing}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, `<w:r><w:rPr><w:highlight w:val="yellow"></w:highlight></w:rPr><w:t>«title»</w:t></w:r>`) {
+		t.Errorf("expected the missing placeholder to be highlighted, got %s", d.Content)
+	}
+	if !strings.Contains(d.Content, "«start:guest»") {
+		t.Errorf("expected the loop without data to be kept, got %s", d.Content)
+	}
+}
+
+func TestHighlightMissingSchemaOrder(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:rPr><w:b/><w:u w:val="single"/><w:lang w:val="de-DE"/></w:rPr><w:t>«title»</w:t></w:r></w:p>`)
+	if err := d.RenderWithOptions(map[string]interface{}{}, docx.RenderOptions{Missing: docx.HighlightMissing}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<w:rPr><w:b></w:b><w:highlight w:val="yellow"></w:highlight><w:u w:val="single"></w:u><w:lang w:val="de-DE"></w:lang></w:rPr>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+}
@@ -0,0 +1,340 @@
+package docx
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"xml"
+)
+
+const contentTypesPart = "[Content_Types].xml"
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const (
+	relationshipImage     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	relationshipHyperlink = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	relationshipCustomXML = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXml"
+	relationshipItemProps = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXmlProps"
+)
+
+// relationships is a relationships part (*.rels) of the package.
+type relationships struct {
+	XMLName      xml.Name       `xml:"http://schemas.openxmlformats.org/package/2006/relationships Relationships"`
+	Relationship []relationship `xml:"Relationship"`
+}
+
+type relationship struct {
+	ID         string `xml:"Id,attr"`
+	Type       string `xml:"Type,attr"`
+	Target     string `xml:"Target,attr"`
+	TargetMode string `xml:"TargetMode,attr,omitempty"`
+}
+
+// contentTypes is the [Content_Types].xml part of the package.
+type contentTypes struct {
+	XMLName   xml.Name              `xml:"http://schemas.openxmlformats.org/package/2006/content-types Types"`
+	Defaults  []contentTypeDefault  `xml:"Default"`
+	Overrides []contentTypeOverride `xml:"Override"`
+}
+
+type contentTypeDefault struct {
+	Extension   string `xml:"Extension,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+type contentTypeOverride struct {
+	PartName    string `xml:"PartName,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+// readFile returns the content of a package part that is not a story part.
+// Parts that have been added or changed are returned with their new content.
+func (d *Docx) readFile(name string) ([]byte, bool, error) {
+	if data, ok := d.changed[name]; ok {
+		return data, true, nil
+	}
+	if d.removed[name] {
+		return nil, false, nil
+	}
+	for _, f := range d.files {
+		if f.Name != name {
+			continue
+		}
+		reader, err := f.Open()
+		if err != nil {
+			return nil, false, err
+		}
+		defer reader.Close()
+		return streamToByte(reader), true, nil
+	}
+	return nil, false, nil
+}
+
+// setFile adds or changes a package part that is not a story part.
+func (d *Docx) setFile(name string, data []byte) {
+	if d.changed == nil {
+		d.changed = make(map[string][]byte)
+	}
+	d.changed[name] = data
+	delete(d.removed, name)
+}
+
+// removeFile removes a part that is not a story part from the package.
+func (d *Docx) removeFile(name string) {
+	delete(d.changed, name)
+	if d.removed == nil {
+		d.removed = make(map[string]bool)
+	}
+	d.removed[name] = true
+}
+
+// hasFile reports whether the package contains the given part.
+func (d *Docx) hasFile(name string) bool {
+	if _, ok := d.changed[name]; ok {
+		return true
+	}
+	if _, ok := d.Parts[name]; ok {
+		return true
+	}
+	if d.removed[name] {
+		return false
+	}
+	for _, f := range d.files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addedFiles returns the names of the parts that are not in the original
+// package, including added story parts.
+func (d *Docx) addedFiles() []string {
+	original := make(map[string]bool)
+	for _, f := range d.files {
+		original[f.Name] = true
+	}
+	var names []string
+	for name := range d.changed {
+		if !original[name] {
+			names = append(names, name)
+		}
+	}
+	for name := range d.Parts {
+		if !original[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// marshalFile encodes v as the content of a package part.
+func (d *Docx) marshalFile(name string, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d.setFile(name, append([]byte(xmlHeader), data...))
+	return nil
+}
+
+// relationshipsPart returns the name of the relationships part of a part,
+// e.g. "word/_rels/document.xml.rels", or of the package for an empty name.
+func relationshipsPart(part string) string {
+	if part == "" {
+		return "_rels/.rels"
+	}
+	return path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+}
+
+// readRelationships returns the relationships of a part.
+func (d *Docx) readRelationships(part string) (*relationships, error) {
+	rels := &relationships{}
+	data, ok, err := d.readFile(relationshipsPart(part))
+	if err != nil || !ok {
+		return rels, err
+	}
+	if err := xml.Unmarshal(data, rels); err != nil {
+		return nil, fmt.Errorf("%s: %v", relationshipsPart(part), err)
+	}
+	return rels, nil
+}
+
+// addRelationship adds a relationship to a part and returns its id.
+// Internal targets are relative to the folder of the part.
+func (d *Docx) addRelationship(part, relType, target string, external bool) (string, error) {
+	rels, err := d.readRelationships(part)
+	if err != nil {
+		return "", err
+	}
+	ids := make(map[string]bool)
+	for _, rel := range rels.Relationship {
+		ids[rel.ID] = true
+	}
+	id := ""
+	for i := len(rels.Relationship) + 1; ; i++ {
+		if id = "rId" + strconv.Itoa(i); !ids[id] {
+			break
+		}
+	}
+	rel := relationship{ID: id, Type: relType, Target: target}
+	if external {
+		rel.TargetMode = "External"
+	}
+	rels.Relationship = append(rels.Relationship, rel)
+	return id, d.marshalFile(relationshipsPart(part), rels)
+}
+
+// removeRelationship removes a relationship of a part. The part it points
+// to is removed as well if no other relationship of the package points to it.
+func (d *Docx) removeRelationship(part, id string) error {
+	rels, err := d.readRelationships(part)
+	if err != nil {
+		return err
+	}
+	target := ""
+	var kept []relationship
+	for _, rel := range rels.Relationship {
+		if rel.ID != id {
+			kept = append(kept, rel)
+		} else if rel.TargetMode != "External" {
+			target = relationshipTarget(part, rel.Target)
+		}
+	}
+	rels.Relationship = kept
+	if err := d.marshalFile(relationshipsPart(part), rels); err != nil {
+		return err
+	}
+	if target == "" || isStoryPart(target) {
+		return nil
+	}
+	all, err := d.Relationships()
+	if err != nil {
+		return err
+	}
+	for _, rel := range all {
+		if !rel.External && rel.Target == target {
+			return nil
+		}
+	}
+	d.removeFile(target)
+	return nil
+}
+
+// readContentTypes returns the content types of the package.
+func (d *Docx) readContentTypes() (*contentTypes, error) {
+	types := &contentTypes{}
+	data, ok, err := d.readFile(contentTypesPart)
+	if err != nil || !ok {
+		return types, err
+	}
+	if err := xml.Unmarshal(data, types); err != nil {
+		return nil, fmt.Errorf("%s: %v", contentTypesPart, err)
+	}
+	return types, nil
+}
+
+// contentType returns the content type of a part.
+func (types *contentTypes) contentType(name string) string {
+	for _, override := range types.Overrides {
+		if override.PartName == "/"+name {
+			return override.ContentType
+		}
+	}
+	extension := strings.TrimPrefix(path.Ext(name), ".")
+	for _, def := range types.Defaults {
+		if strings.EqualFold(def.Extension, extension) {
+			return def.ContentType
+		}
+	}
+	return ""
+}
+
+// addDefaultContentType registers the content type of a file extension.
+func (d *Docx) addDefaultContentType(extension, contentType string) error {
+	types, err := d.readContentTypes()
+	if err != nil {
+		return err
+	}
+	for _, def := range types.Defaults {
+		if strings.EqualFold(def.Extension, extension) {
+			return nil
+		}
+	}
+	types.Defaults = append(types.Defaults, contentTypeDefault{Extension: extension, ContentType: contentType})
+	return d.marshalFile(contentTypesPart, types)
+}
+
+// addOverrideContentType registers the content type of a part, e.g. "/customXml/itemProps1.xml".
+func (d *Docx) addOverrideContentType(partName, contentType string) error {
+	types, err := d.readContentTypes()
+	if err != nil {
+		return err
+	}
+	for _, override := range types.Overrides {
+		if override.PartName == partName {
+			return nil
+		}
+	}
+	types.Overrides = append(types.Overrides, contentTypeOverride{PartName: partName, ContentType: contentType})
+	return d.marshalFile(contentTypesPart, types)
+}
+
+// fileNames returns the names of all parts of the package, including the added ones.
+func (d *Docx) fileNames() []string {
+	var names []string
+	for _, f := range d.files {
+		if !d.removed[f.Name] {
+			names = append(names, f.Name)
+		}
+	}
+	for _, name := range d.addedFiles() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// newPartName returns an unused part name like "word/media/image3.png".
+func (d *Docx) newPartName(prefix, extension string) string {
+	for i := 1; ; i++ {
+		name := prefix + strconv.Itoa(i) + extension
+		if !d.hasFile(name) {
+			return name
+		}
+	}
+}
+
+// snapshot holds the content of a docx, to restore it if an operation fails.
+type snapshot struct {
+	content string
+	parts   map[string]string
+	changed map[string][]byte
+	removed map[string]bool
+}
+
+func (d *Docx) snapshot() *snapshot {
+	s := &snapshot{content: d.Content, parts: make(map[string]string, len(d.Parts)), changed: copyFiles(d.changed), removed: make(map[string]bool)}
+	for name, content := range d.Parts {
+		s.parts[name] = content
+	}
+	for name := range d.removed {
+		s.removed[name] = true
+	}
+	return s
+}
+
+func (d *Docx) restore(s *snapshot) {
+	d.Content, d.Parts, d.changed, d.removed = s.content, s.parts, s.changed, s.removed
+}
+
+// copyFiles returns a copy of the changed parts, to restore them if an operation fails.
+func copyFiles(files map[string][]byte) map[string][]byte {
+	result := make(map[string][]byte, len(files))
+	for name, data := range files {
+		result[name] = data
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package docx
+
+import (
+	"archive/zip"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const documentPart = "word/document.xml"
+
+// isStoryPart reports whether a package part, other than the main document,
+// holds text: headers, footers, footnotes, endnotes and comments.
+func isStoryPart(name string) bool {
+	switch name {
+	case "word/footnotes.xml", "word/endnotes.xml", "word/comments.xml":
+		return true
+	}
+	return strings.HasSuffix(name, ".xml") && !strings.Contains(strings.TrimPrefix(name, "word/"), "/") &&
+		(strings.HasPrefix(name, "word/header") || strings.HasPrefix(name, "word/footer"))
+}
+
+// readParts reads the content of all story parts besides the main document.
+func readParts(files []*zip.File) (map[string]string, error) {
+	parts := make(map[string]string)
+	for _, f := range files {
+		if !isStoryPart(f.Name) {
+			continue
+		}
+		reader, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := wordDocToString(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		parts[f.Name] = content
+	}
+	return parts, nil
+}
+
+// PartNames returns the names of all story parts of the docx:
+// the main document first, followed by headers, footers, footnotes,
+// endnotes and comments in alphabetical order.
+func (d *Docx) PartNames() []string {
+	var names []string
+	for name := range d.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{documentPart}, names...)
+}
+
+// selectParts returns the given part names, or all story parts if none are given.
+func (d *Docx) selectParts(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return d.PartNames(), nil
+	}
+	for _, name := range names {
+		if _, ok := d.Parts[name]; !ok && name != documentPart {
+			return nil, fmt.Errorf("part %q not found", name)
+		}
+	}
+	return names, nil
+}
+
+// part returns the content of a story part.
+func (d *Docx) part(name string) string {
+	if name == documentPart {
+		return d.Content
+	}
+	return d.Parts[name]
+}
+
+// setPart sets the content of a story part.
+func (d *Docx) setPart(name string, content string) {
+	if name == documentPart {
+		d.Content = content
+	} else {
+		d.Parts[name] = content
+	}
+}
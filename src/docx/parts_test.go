@@ -0,0 +1,152 @@
+package docx_test
+
+import (
+	"bytes"
+	"docx"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHeader = `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:p><w:r><w:t>Ref. «reference»</w:t></w:r></w:p></w:hdr>`
+const testFootnotes = `<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:footnote w:id="1"><w:p><w:r><w:t>«start:source»«title»; «end:source»</w:t></w:r></w:p></w:footnote></w:footnotes>`
+
+func newTestStoryDocx(t *testing.T) *docx.Docx {
+	return openTestPackage(t, map[string]string{
+		"word/document.xml":  testDocumentStart + `<w:p><w:r><w:t>«reference»</w:t></w:r></w:p>` + testDocumentEnd,
+		"word/header1.xml":   testHeader,
+		"word/footnotes.xml": testFootnotes,
+		"word/styles.xml":    `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"/>`,
+	}).Editable()
+}
+
+func TestPartNames(t *testing.T) {
+	d := newTestStoryDocx(t)
+	expected := []string{"word/document.xml", "word/footnotes.xml", "word/header1.xml"}
+	if actual := d.PartNames(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestReplaceInStoryParts(t *testing.T) {
+	d := newTestStoryDocx(t)
+	if err := d.Replace("reference", "A-42", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReplaceLoop("source", []map[string]string{{"title": "Guide"}, {"title": "Book"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, "A-42") || texts(d.Parts["word/header1.xml"]) != "Ref. |A-42" {
+		t.Errorf("expected the reference to be replaced in document and header, got %s and %s", d.Content, d.Parts["word/header1.xml"])
+	}
+	if expected, actual := "Guide|; |Book|; ", texts(d.Parts["word/footnotes.xml"]); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := docx.ReadDoxFileFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := r.Editable().Parts["word/header1.xml"]; !strings.Contains(header, "A-42") {
+		t.Errorf("expected the written header to be replaced, got %s", header)
+	}
+}
+
+func TestReplaceNumAcrossParts(t *testing.T) {
+	d := newTestStoryDocx(t)
+	if err := d.Replace("reference", "A-42", 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, "A-42") || strings.Contains(d.Parts["word/header1.xml"], "A-42") {
+		t.Errorf("expected only the first placeholder to be replaced")
+	}
+}
+
+func TestRenderSelectedParts(t *testing.T) {
+	d := newTestStoryDocx(t)
+	options := docx.RenderOptions{Parts: []string{"word/header1.xml"}}
+	if err := d.RenderWithOptions(map[string]string{"reference": "A-42"}, options); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(d.Content, "A-42") || !strings.Contains(d.Parts["word/header1.xml"], "A-42") {
+		t.Errorf("expected only the header to be rendered")
+	}
+
+	options.Parts = []string{"word/header9.xml"}
+	if err := d.RenderWithOptions(nil, options); err == nil {
+		t.Errorf("expected an error for an unknown part")
+	}
+}
+
+// checkWellFormed parses every XML part of a written docx. The decoder
+// does not reject duplicate attributes, so they are checked here.
+func checkWellFormed(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".xml") && !strings.HasSuffix(name, ".rels") {
+			continue
+		}
+		decoder := xml.NewDecoder(strings.NewReader(content))
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+			if start, ok := token.(xml.StartElement); ok {
+				seen := make(map[xml.Name]bool)
+				for _, a := range start.Attr {
+					if seen[a.Name] {
+						t.Errorf("%s: duplicate attribute %s:%s in <%s>", name, a.Name.Space, a.Name.Local, start.Name.Local)
+					}
+					seen[a.Name] = true
+				}
+			}
+		}
+	}
+}
+
+func TestRenderTwiceWritesWellFormedParts(t *testing.T) {
+	data, err := ioutil.ReadFile("template.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := docx.ReadDoxFileFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := r.Editable()
+	if err := d.ReplaceLoop("topic", []map[string]string{{"name": "Atoms", "pos": "TOP 01", "user": "Niels Bohr"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReplaceLoop("participant", []map[string]string{{"name": "Niels Bohr"}}); err != nil {
+		t.Fatal(err)
+	}
+	files := writtenFiles(t, d)
+	checkWellFormed(t, files)
+	if !strings.Contains(files["word/header1.xml"], `<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">`) {
+		t.Errorf("expected the drawing of the header to keep its prefix, got %s", files["word/header1.xml"])
+	}
+}
+
+func TestMergedRunsKeepDeclarations(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«na</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>me»</w:t></w:r></w:p>`)
+	if err := d.Render(map[string]string{"name": "Arthur"}); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(d.Content, "xmlns:w="); count != 1 {
+		t.Errorf("expected the prefix to be declared once, got %s", d.Content)
+	}
+}
@@ -0,0 +1,565 @@
+package docx
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"xml"
+)
+
+const (
+	corePropertiesPart   = "docProps/core.xml"
+	appPropertiesPart    = "docProps/app.xml"
+	customPropertiesPart = "docProps/custom.xml"
+)
+
+const (
+	corePropertiesNS   = "http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+	dcNS               = "http://purl.org/dc/elements/1.1/"
+	dctermsNS          = "http://purl.org/dc/terms/"
+	dcmitypeNS         = "http://purl.org/dc/dcmitype/"
+	xsiNS              = "http://www.w3.org/2001/XMLSchema-instance"
+	appPropertiesNS    = "http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"
+	customPropertiesNS = "http://schemas.openxmlformats.org/officeDocument/2006/custom-properties"
+	variantTypesNS     = "http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"
+)
+
+const (
+	relationshipCoreProperties   = "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties"
+	relationshipAppProperties    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties"
+	relationshipCustomProperties = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties"
+)
+
+// customPropertyFormatID is the format id Word uses for all custom properties.
+const customPropertyFormatID = "{D5CDD505-2E9C-101B-9397-08002B2CF9AE}"
+
+// propertiesParts describes the properties parts: their root element,
+// the namespaces declared by new parts, the relationship and the content type.
+var propertiesParts = map[string]struct {
+	root        xml.Name
+	namespaces  [][2]string
+	relType     string
+	contentType string
+}{
+	corePropertiesPart: {
+		xml.Name{Space: corePropertiesNS, Local: "coreProperties"},
+		[][2]string{{"cp", corePropertiesNS}, {"dc", dcNS}, {"dcterms", dctermsNS}, {"dcmitype", dcmitypeNS}, {"xsi", xsiNS}},
+		relationshipCoreProperties,
+		"application/vnd.openxmlformats-package.core-properties+xml",
+	},
+	appPropertiesPart: {
+		xml.Name{Space: appPropertiesNS, Local: "Properties"},
+		[][2]string{{"vt", variantTypesNS}},
+		relationshipAppProperties,
+		"application/vnd.openxmlformats-officedocument.extended-properties+xml",
+	},
+	customPropertiesPart: {
+		xml.Name{Space: customPropertiesNS, Local: "Properties"},
+		[][2]string{{"vt", variantTypesNS}},
+		relationshipCustomProperties,
+		"application/vnd.openxmlformats-officedocument.custom-properties+xml",
+	},
+}
+
+// CoreProperties are the core properties of a document (docProps/core.xml),
+// shown by Word as title, author, tags and so on.
+type CoreProperties struct {
+	Title, Subject, Creator, Keywords, Description, LastModifiedBy, Category string
+	// Revision is the number of times the document has been saved.
+	Revision int
+	// Created and Modified are left out if they are zero.
+	Created, Modified time.Time
+}
+
+// AppProperties are the application-specific properties of a document (docProps/app.xml).
+type AppProperties struct {
+	Company, Manager, Template string
+}
+
+// textProperty is a property whose value is the text of an element.
+type textProperty struct {
+	name  xml.Name
+	value *string
+}
+
+// dateProperty is a property whose value is a W3CDTF date.
+type dateProperty struct {
+	name  xml.Name
+	value *time.Time
+}
+
+func (p *CoreProperties) texts() []textProperty {
+	return []textProperty{
+		{xml.Name{Space: dcNS, Local: "title"}, &p.Title},
+		{xml.Name{Space: dcNS, Local: "subject"}, &p.Subject},
+		{xml.Name{Space: dcNS, Local: "creator"}, &p.Creator},
+		{xml.Name{Space: corePropertiesNS, Local: "keywords"}, &p.Keywords},
+		{xml.Name{Space: dcNS, Local: "description"}, &p.Description},
+		{xml.Name{Space: corePropertiesNS, Local: "lastModifiedBy"}, &p.LastModifiedBy},
+		{xml.Name{Space: corePropertiesNS, Local: "category"}, &p.Category},
+	}
+}
+
+func (p *CoreProperties) dates() []dateProperty {
+	return []dateProperty{
+		{xml.Name{Space: dctermsNS, Local: "created"}, &p.Created},
+		{xml.Name{Space: dctermsNS, Local: "modified"}, &p.Modified},
+	}
+}
+
+func (p *AppProperties) texts() []textProperty {
+	return []textProperty{
+		{xml.Name{Space: appPropertiesNS, Local: "Company"}, &p.Company},
+		{xml.Name{Space: appPropertiesNS, Local: "Manager"}, &p.Manager},
+		{xml.Name{Space: appPropertiesNS, Local: "Template"}, &p.Template},
+	}
+}
+
+var revisionName = xml.Name{Space: corePropertiesNS, Local: "revision"}
+
+// CoreProperties returns the core properties of the document.
+func (d *Docx) CoreProperties() (*CoreProperties, error) {
+	p := &CoreProperties{}
+	root, err := d.readProperties(corePropertiesPart)
+	if err != nil || root == nil {
+		return p, err
+	}
+	for _, text := range p.texts() {
+		*text.value = propertyText(root, text.name)
+	}
+	if revision := propertyText(root, revisionName); revision != "" {
+		if p.Revision, err = strconv.Atoi(revision); err != nil {
+			return nil, fmt.Errorf("%s: invalid revision %q", corePropertiesPart, revision)
+		}
+	}
+	for _, date := range p.dates() {
+		if text := propertyText(root, date.name); text != "" {
+			if *date.value, err = parseW3CDTF(text); err != nil {
+				return nil, fmt.Errorf("%s: invalid date %q", corePropertiesPart, text)
+			}
+		}
+	}
+	return p, nil
+}
+
+// SetCoreProperties sets the core properties of the document.
+// Empty properties are removed, the part is added if it is missing.
+func (d *Docx) SetCoreProperties(p *CoreProperties) error {
+	root, err := d.readProperties(corePropertiesPart)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		root = newPropertiesRoot(corePropertiesPart)
+	}
+	for _, text := range p.texts() {
+		setPropertyText(root, text.name, *text.value)
+	}
+	revision := ""
+	if p.Revision != 0 {
+		revision = strconv.Itoa(p.Revision)
+	}
+	setPropertyText(root, revisionName, revision)
+	for _, date := range p.dates() {
+		text := ""
+		if !date.value.IsZero() {
+			text = date.value.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		if el := setPropertyText(root, date.name, text); el != nil {
+			el.Attr = []xml.Attr{{Name: xml.Name{Space: xsiNS, Local: "type"}, Value: "dcterms:W3CDTF"}}
+		}
+	}
+	return d.writeProperties(corePropertiesPart, root)
+}
+
+// AppProperties returns the application-specific properties of the document.
+func (d *Docx) AppProperties() (*AppProperties, error) {
+	p := &AppProperties{}
+	root, err := d.readProperties(appPropertiesPart)
+	if err != nil || root == nil {
+		return p, err
+	}
+	for _, text := range p.texts() {
+		*text.value = propertyText(root, text.name)
+	}
+	return p, nil
+}
+
+// SetAppProperties sets the application-specific properties of the document.
+// Empty properties are removed, the part is added if it is missing.
+func (d *Docx) SetAppProperties(p *AppProperties) error {
+	root, err := d.readProperties(appPropertiesPart)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		root = newPropertiesRoot(appPropertiesPart)
+	}
+	for _, text := range p.texts() {
+		setPropertyText(root, text.name, *text.value)
+	}
+	return d.writeProperties(appPropertiesPart, root)
+}
+
+// CustomProperties returns the custom properties of the document by name.
+// Texts are returned as string, whole numbers as int, other numbers as
+// float64, yes/no values as bool and dates as time.Time.
+func (d *Docx) CustomProperties() (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	root, err := d.readProperties(customPropertiesPart)
+	if err != nil || root == nil {
+		return properties, err
+	}
+	for _, p := range customProperties(root) {
+		name := propertyAttr(p, "name")
+		for _, c := range p.children {
+			if el, ok := c.(*element); ok && el.Name.Space == variantTypesNS {
+				if properties[name], err = variantValue(el); err != nil {
+					return nil, fmt.Errorf("%s: property %q: %v", customPropertiesPart, name, err)
+				}
+				break
+			}
+		}
+	}
+	return properties, nil
+}
+
+// SetCustomProperty adds or changes a custom property. The value may be a
+// string, a number, a bool or a time.Time; nil removes the property.
+// The part is added if it is missing.
+func (d *Docx) SetCustomProperty(name string, value interface{}) error {
+	root, err := d.readProperties(customPropertiesPart)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		root = newPropertiesRoot(customPropertiesPart)
+	}
+	var variant *element
+	if value != nil {
+		if variant, err = variantElement(value); err != nil {
+			return fmt.Errorf("property %q: %v", name, err)
+		}
+	}
+
+	pid := 1
+	var children []xml.Token
+	var property *element
+	for _, c := range root.children {
+		if el, ok := c.(*element); ok && el.Name == (xml.Name{Space: customPropertiesNS, Local: "property"}) {
+			if n, err := strconv.Atoi(propertyAttr(el, "pid")); err == nil && n > pid {
+				pid = n
+			}
+			if propertyAttr(el, "name") == name {
+				property = el
+				if variant == nil {
+					continue
+				}
+			}
+		}
+		children = append(children, c)
+	}
+	root.children = children
+	if variant != nil {
+		if property == nil {
+			property = &element{StartElement: xml.StartElement{Name: xml.Name{Space: customPropertiesNS, Local: "property"}, Attr: []xml.Attr{
+				attr("fmtid", customPropertyFormatID), attr("pid", strconv.Itoa(pid+1)), attr("name", name),
+			}}}
+			root.children = append(root.children, property)
+		}
+		property.children = []xml.Token{variant}
+	}
+	return d.writeProperties(customPropertiesPart, root)
+}
+
+// customProperties returns the <property> elements of the custom properties.
+func customProperties(root *element) []*element {
+	var properties []*element
+	for _, c := range root.children {
+		if el, ok := c.(*element); ok && el.Name == (xml.Name{Space: customPropertiesNS, Local: "property"}) {
+			properties = append(properties, el)
+		}
+	}
+	return properties
+}
+
+// propertyAttr returns an unqualified attribute.
+func propertyAttr(e *element, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// variantValue converts the value of a custom property, e.g. <vt:i4>42</vt:i4>.
+func variantValue(e *element) (interface{}, error) {
+	text := xmlText(e)
+	switch e.Name.Local {
+	case "i1", "i2", "i4", "i8", "int", "ui1", "ui2", "ui4", "ui8", "uint":
+		n, err := strconv.ParseInt(text, 10, 64)
+		return int(n), err
+	case "r4", "r8", "decimal":
+		return strconv.ParseFloat(text, 64)
+	case "bool":
+		return text == "true" || text == "1", nil
+	case "filetime", "date":
+		return parseW3CDTF(text)
+	}
+	return text, nil
+}
+
+// w3cdtfLayouts are the formats of W3CDTF dates, from the most to the least precise.
+var w3cdtfLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"}
+
+// parseW3CDTF parses a date of the document properties. Besides full
+// timestamps, W3CDTF allows dates without time, like "2016-08-18".
+func parseW3CDTF(text string) (time.Time, error) {
+	for _, layout := range w3cdtfLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a W3CDTF date", text)
+}
+
+// variantElement returns the element holding the value of a custom property.
+func variantElement(value interface{}) (*element, error) {
+	local, text := "", ""
+	v := indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.String:
+		local, text = "lpwstr", v.String()
+	case reflect.Bool:
+		local, text = "bool", strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		local, text = "i4", strconv.FormatInt(v.Int(), 10)
+		if v.Int() < math.MinInt32 || v.Int() > math.MaxInt32 {
+			local = "i8"
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		local, text = "ui4", strconv.FormatUint(v.Uint(), 10)
+		if v.Uint() > math.MaxUint32 {
+			local = "ui8"
+		}
+	case reflect.Float32, reflect.Float64:
+		local, text = "r8", strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	default:
+		t, ok := v.Interface().(time.Time)
+		if !v.IsValid() || !ok {
+			return nil, fmt.Errorf("unsupported type %T", value)
+		}
+		local, text = "filetime", t.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	e := newElement(variantTypesNS, local)
+	e.children = []xml.Token{xml.CharData(text)}
+	return e, nil
+}
+
+// readProperties returns the root element of a properties part, or nil if it is missing.
+func (d *Docx) readProperties(name string) (*element, error) {
+	data, ok, err := d.readFile(name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	tokens, err := readTokens(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	for _, n := range buildTree(tokens) {
+		if el, ok := n.(*element); ok {
+			return el, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no root element", name)
+}
+
+// newPropertiesRoot returns the empty root element of a properties part.
+func newPropertiesRoot(name string) *element {
+	part := propertiesParts[name]
+	root := &element{StartElement: xml.StartElement{Name: part.root}}
+	for _, ns := range part.namespaces {
+		root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Space: "xmlns", Local: ns[0]}, Value: ns[1]})
+	}
+	return root
+}
+
+// writeProperties writes a properties part. A part that is new is
+// added to the relationships and content types of the package.
+func (d *Docx) writeProperties(name string, root *element) error {
+	content, err := encodeProperties(root)
+	if err != nil {
+		return err
+	}
+	if !d.hasFile(name) {
+		part := propertiesParts[name]
+		if _, err := d.addRelationship("", part.relType, name, false); err != nil {
+			return err
+		}
+		if err := d.addOverrideContentType("/"+name, part.contentType); err != nil {
+			return err
+		}
+	}
+	d.setFile(name, content)
+	return nil
+}
+
+// encodeProperties encodes the root element of a properties part.
+func encodeProperties(root *element) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	encoder := xml.NewEncoder(&buf)
+	encoder.PrefixElements(true)
+	encoder.Namespace("xmlns", "xmlns")
+	for _, part := range propertiesParts {
+		for _, ns := range part.namespaces {
+			encoder.Namespace(ns[0], ns[1])
+		}
+	}
+	if err := encodeTree(encoder, []xml.Token{withoutDefaultNamespace(root, "")}); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// withoutDefaultNamespace returns a copy of e without xmlns attributes,
+// which the encoder writes itself for elements without prefix.
+// Elements in the namespace of their parent inherit it.
+func withoutDefaultNamespace(e *element, parent string) *element {
+	result := &element{StartElement: e.StartElement.Copy()}
+	result.Attr = nil
+	for _, a := range e.Attr {
+		if a.Name.Space != "" || a.Name.Local != "xmlns" {
+			result.Attr = append(result.Attr, a)
+		}
+	}
+	if e.Name.Space == parent {
+		result.Name.Space = ""
+	}
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok {
+			c = withoutDefaultNamespace(el, e.Name.Space)
+		}
+		result.children = append(result.children, c)
+	}
+	return result
+}
+
+// propertyText returns the text of a property element.
+func propertyText(root *element, name xml.Name) string {
+	for _, c := range root.children {
+		if el, ok := c.(*element); ok && el.Name == name {
+			return xmlText(el)
+		}
+	}
+	return ""
+}
+
+// setPropertyText sets the text of a property element and returns it.
+// The element is removed if the text is empty.
+func setPropertyText(root *element, name xml.Name, text string) *element {
+	var children []xml.Token
+	var property *element
+	for _, c := range root.children {
+		if el, ok := c.(*element); ok && el.Name == name {
+			if text == "" || property != nil {
+				continue
+			}
+			property = el
+		}
+		children = append(children, c)
+	}
+	root.children = children
+	if text == "" {
+		return nil
+	}
+	if property == nil {
+		property = &element{StartElement: xml.StartElement{Name: name}}
+		root.children = append(root.children, property)
+	}
+	property.children = []xml.Token{xml.CharData(text)}
+	return property
+}
+
+// renderProperties renders the placeholders in the values of the document
+// properties and returns the changed parts.
+func (r *renderer) renderProperties(data interface{}) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, name := range []string{corePropertiesPart, appPropertiesPart, customPropertiesPart} {
+		root, err := r.docx.readProperties(name)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil || !r.renderPropertyText(root, &scope{data: data}) {
+			continue
+		}
+		if files[name], err = encodeProperties(root); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// renderPropertyText renders the placeholders in the text below e
+// and reports whether there have been any.
+func (r *renderer) renderPropertyText(e *element, s *scope) bool {
+	rendered := false
+	for i, c := range e.children {
+		switch node := c.(type) {
+		case xml.CharData:
+			if text, ok := r.renderText(string(node), s); ok {
+				e.children[i] = xml.CharData(text)
+				rendered = true
+			}
+		case *element:
+			if r.renderPropertyText(node, s) {
+				rendered = true
+			}
+		}
+	}
+	return rendered
+}
+
+// renderText renders the placeholders within a text,
+// e.g. "Contract «number» for «client.name»".
+func (r *renderer) renderText(text string, s *scope) (string, bool) {
+	var b strings.Builder
+	rendered := false
+	for {
+		start := strings.Index(text, mergeFieldOpenTag)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start:], mergeFieldCloseTag)
+		if end < 0 {
+			break
+		}
+		end += start + len(mergeFieldCloseTag)
+		b.WriteString(text[:start])
+		name, ok := placeholderName(text[start:end])
+		if !ok {
+			b.WriteString(text[start:end])
+			text = text[end:]
+			continue
+		}
+		f := newField(name)
+		f.text = xml.CharData(text[start:end])
+		for _, t := range r.render([]xml.Token{f}, s) {
+			if data, ok := t.(xml.CharData); ok {
+				b.Write(data)
+			}
+		}
+		rendered = true
+		text = text[end:]
+	}
+	b.WriteString(text)
+	return b.String(), rendered
+}
@@ -0,0 +1,168 @@
+package docx_test
+
+import (
+	"docx"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCoreProperties = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" ` +
+	`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" ` +
+	`xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+	`<dc:title>Contract «number»</dc:title><dc:creator>Template Designer</dc:creator>` +
+	`<cp:lastModifiedBy>Template Designer</cp:lastModifiedBy><cp:revision>7</cp:revision>` +
+	`<dcterms:created xsi:type="dcterms:W3CDTF">2016-05-04T10:00:00Z</dcterms:created>` +
+	`</cp:coreProperties>`
+
+const testAppProperties = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" ` +
+	`xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` +
+	`<Template>Normal.dotm</Template><Pages>1</Pages><Company>Template Corp</Company></Properties>`
+
+func TestCoreProperties(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p/>` + testDocumentEnd,
+		"docProps/core.xml": testCoreProperties,
+	}).Editable()
+
+	p, err := d.CoreProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Creator != "Template Designer" || p.Revision != 7 || !p.Created.Equal(time.Date(2016, 5, 4, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected core properties %+v", p)
+	}
+
+	p.Creator, p.LastModifiedBy, p.Keywords = "Contracts", "", "contract, sale"
+	p.Modified = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := d.SetCoreProperties(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Render(map[string]string{"number": "A-42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	core := writtenFiles(t, d)["docProps/core.xml"]
+	for _, s := range []string{
+		"<dc:title>Contract A-42</dc:title>",
+		"<dc:creator>Contracts</dc:creator>",
+		"<cp:keywords>contract, sale</cp:keywords>",
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">2017-01-02T03:04:05Z</dcterms:modified>`,
+		`<dcterms:created xsi:type="dcterms:W3CDTF">2016-05-04T10:00:00Z</dcterms:created>`,
+	} {
+		if !strings.Contains(core, s) {
+			t.Errorf("expected %s, got %s", s, core)
+		}
+	}
+	if strings.Contains(core, "lastModifiedBy") {
+		t.Errorf("expected lastModifiedBy to be removed, got %s", core)
+	}
+}
+
+func TestPropertiesDateOnly(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p/>` + testDocumentEnd,
+		"docProps/core.xml": strings.Replace(testCoreProperties, "2016-05-04T10:00:00Z", "2016-08-18", 1),
+		"docProps/custom.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" ` +
+			`xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` +
+			`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="Signed">` +
+			`<vt:filetime>2016-08-18</vt:filetime></property></Properties>`,
+	}).Editable()
+	date := time.Date(2016, 8, 18, 0, 0, 0, 0, time.UTC)
+	core, err := d.CoreProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !core.Created.Equal(date) {
+		t.Errorf("expected the date of creation, got %v", core.Created)
+	}
+	custom, err := d.CustomProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed, _ := custom["Signed"].(time.Time); !signed.Equal(date) {
+		t.Errorf("expected the date of signature, got %v", custom["Signed"])
+	}
+}
+
+func TestAppProperties(t *testing.T) {
+	d := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p/>` + testDocumentEnd,
+		"docProps/app.xml":  testAppProperties,
+	}).Editable()
+
+	p, err := d.AppProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != (docx.AppProperties{Company: "Template Corp", Template: "Normal.dotm"}) {
+		t.Errorf("unexpected app properties %+v", p)
+	}
+	p.Company, p.Manager = "Sirius Cybernetics", "Zaphod"
+	if err := d.SetAppProperties(p); err != nil {
+		t.Fatal(err)
+	}
+	app := writtenFiles(t, d)["docProps/app.xml"]
+	for _, s := range []string{"<Pages>1</Pages>", "<Company>Sirius Cybernetics</Company>", "<Manager>Zaphod</Manager>"} {
+		if !strings.Contains(app, s) {
+			t.Errorf("expected %s, got %s", s, app)
+		}
+	}
+	if strings.Count(app, "xmlns=") != 1 {
+		t.Errorf("expected a single default namespace, got %s", app)
+	}
+}
+
+func TestCustomProperties(t *testing.T) {
+	d := newTestDocx(t, `<w:p/>`)
+	signed := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	values := map[string]interface{}{
+		"Client":  "ACME «client»",
+		"Amount":  1234.5,
+		"Items":   3,
+		"Signed":  signed,
+		"Renewal": true,
+	}
+	for name, value := range values {
+		if err := d.SetCustomProperty(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.SetCustomProperty("Renewal", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetCustomProperty("Tags", []string{"a"}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+	if err := d.Render(map[string]string{"client": "Corp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	properties, err := d.CustomProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"Client": "ACME Corp", "Amount": 1234.5, "Items": 3, "Signed": signed}
+	if len(properties) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, properties)
+	}
+	for name, value := range expected {
+		if properties[name] != value {
+			t.Errorf("expected %s to be %v, got %v", name, value, properties[name])
+		}
+	}
+
+	files := writtenFiles(t, d)
+	if !strings.Contains(files["_rels/.rels"], `Target="docProps/custom.xml"`) {
+		t.Errorf("expected a relationship to the custom properties, got %s", files["_rels/.rels"])
+	}
+	if !strings.Contains(files["[Content_Types].xml"], `PartName="/docProps/custom.xml"`) {
+		t.Errorf("expected a content type for the custom properties, got %s", files["[Content_Types].xml"])
+	}
+	if !strings.Contains(files["docProps/custom.xml"], `<vt:i4>3</vt:i4>`) {
+		t.Errorf("expected typed values, got %s", files["docProps/custom.xml"])
+	}
+}
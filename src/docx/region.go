@@ -0,0 +1,456 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+	"xml"
+)
+
+// field is a «placeholder» within a parsed template.
+type field struct {
+	name      string
+	format    []formatCall // formatters applied to the value, e.g. «amount|number:2»
+	formatErr error        // error parsing the formatters
+	run       *element     // the run holding the placeholder
+	text      xml.CharData // the placeholder text, if it is not in a run of its own
+	original  []xml.Token  // the MERGEFIELD field the placeholder has been converted from
+	paragraph int          // index of the enclosing paragraph within the part, -1 if there is none
+}
+
+// newField creates a field for the text of a placeholder, e.g. "amount|number:2".
+func newField(text string) *field {
+	f := &field{}
+	f.name, f.format, f.formatErr = splitFormat(text)
+	return f
+}
+
+// loop is a region between a «start:name» and an «end:name» marker.
+// It is repeated for each element of the corresponding data.
+type loop struct {
+	name       string
+	start, end *field
+	body       []xml.Token
+	source     []xml.Token // the region as written in the template
+}
+
+// condition is a region between an «if:name» and an «endif:name» marker,
+// optionally split by an «else:name» marker.
+type condition struct {
+	name                   string
+	start, elseMarker, end *field
+	then, otherwise        []xml.Token
+	source                 []xml.Token // the region as written in the template
+}
+
+// parseTemplate turns the tokens of a WordprocessingML part into a token tree.
+// Placeholders become *field values, regions between loop markers become
+// *loop values and conditional sections become *condition values.
+// All other tokens are kept as they are.
+//
+// A region spans whole elements: the children of the nearest common ancestor
+// of its markers, from the one holding the start marker to the one holding
+// the end marker. Regions whose markers are in different cells of a table
+// row span the whole row. Paragraphs and rows that hold nothing but a marker
+// are removed from the region. Column loops (see expandColumnLoops) are
+// expanded before the other regions.
+func parseTemplate(tokens []xml.Token) ([]xml.Token, error) {
+	nodes := convertMergeFields(buildTree(collectFields(tokens)))
+	if err := expandColumnLoops(nodes); err != nil {
+		return nil, err
+	}
+	regions, err := pairMarkers(findMarkers(nodes, nil))
+	if err != nil {
+		return nil, err
+	}
+	p := &regionParser{regions: regions}
+	return p.nest(nodes, nil)
+}
+
+// collectFields replaces every run that consists of a single placeholder by a *field.
+func collectFields(tokens []xml.Token) []xml.Token {
+	var result []xml.Token
+	var paragraphs []int
+	count := 0
+	paragraph := func() int {
+		if len(paragraphs) == 0 {
+			return -1
+		}
+		return paragraphs[len(paragraphs)-1]
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch node := tokens[i].(type) {
+		case xml.StartElement:
+			if node.Name.Space == wordNamespace && node.Name.Local == "p" {
+				paragraphs = append(paragraphs, count)
+				count++
+			}
+			if node.Name.Space == wordNamespace && node.Name.Local == "r" {
+				end := matchingEnd(tokens, i)
+				run := buildTree(tokens[i : end+1])[0].(*element)
+				if name, ok := placeholderName(run.text()); ok && isPlaceholderRun(run) {
+					f := newField(name)
+					f.run, f.paragraph = run, paragraph()
+					result = append(result, f)
+					i = end
+					continue
+				}
+			}
+		case xml.EndElement:
+			if node.Name.Space == wordNamespace && node.Name.Local == "p" && len(paragraphs) > 0 {
+				paragraphs = paragraphs[:len(paragraphs)-1]
+			}
+		case xml.CharData:
+			if name, ok := placeholderName(strings.Trim(string(node), " ")); ok {
+				f := newField(name)
+				f.text, f.paragraph = node, paragraph()
+				result = append(result, f)
+				continue
+			}
+		}
+		result = append(result, tokens[i])
+	}
+	return result
+}
+
+// matchingEnd returns the index of the end element matching the start element at tokens[start].
+func matchingEnd(tokens []xml.Token, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i].(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// placeholderName returns the name of a «placeholder».
+func placeholderName(text string) (string, bool) {
+	if !strings.HasPrefix(text, mergeFieldOpenTag) || !strings.HasSuffix(text, mergeFieldCloseTag) {
+		return "", false
+	}
+	name := text[len(mergeFieldOpenTag) : len(text)-len(mergeFieldCloseTag)]
+	if strings.Contains(name, mergeFieldOpenTag) || strings.Contains(name, mergeFieldCloseTag) {
+		return "", false
+	}
+	return strings.TrimSpace(name), true
+}
+
+// marker is a loop or condition marker together with the elements enclosing it.
+type marker struct {
+	field     *field
+	ancestors []*element // from the outermost element to the one holding the field
+}
+
+// regionMarkers are the markers of a single loop or condition.
+type regionMarkers struct {
+	name                   string
+	isLoop                 bool
+	start, elseMarker, end *marker
+	owner                  *element // element whose children the region spans, nil for the top level
+	done                   bool
+}
+
+// isRegionMarker reports whether a placeholder name is a loop or condition marker.
+func isRegionMarker(name string) bool {
+	for _, prefix := range []string{loopStartPrefix, loopEndPrefix, conditionPrefix, conditionElsePrefix, conditionEndPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findMarkers returns the region markers of a token tree in document order.
+func findMarkers(nodes []xml.Token, ancestors []*element) []*marker {
+	var markers []*marker
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *field:
+			if isRegionMarker(node.name) {
+				markers = append(markers, &marker{field: node, ancestors: ancestors})
+			}
+		case *element:
+			inner := append(ancestors[:len(ancestors):len(ancestors)], node)
+			markers = append(markers, findMarkers(node.children, inner)...)
+		case *loop:
+			markers = append(markers, findMarkers(node.body, ancestors)...)
+		}
+	}
+	return markers
+}
+
+// pairMarkers matches the start, else and end markers of the regions.
+// Regions may be nested to any depth, but must not cross each other.
+// The regions are returned in the order of their start markers.
+func pairMarkers(markers []*marker) ([]*regionMarkers, error) {
+	var regions, stack []*regionMarkers
+	// closeRegion pops the innermost region, which has to be called name
+	closeRegion := func(name string) (*regionMarkers, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("region %q ends without being started", name)
+		}
+		top := stack[len(stack)-1]
+		if top.name != name {
+			return nil, fmt.Errorf("region %q ends before the inner region %q", name, top.name)
+		}
+		stack = stack[:len(stack)-1]
+		return top, nil
+	}
+
+	for _, m := range markers {
+		name := m.field.name
+		switch {
+		case strings.HasPrefix(name, loopStartPrefix):
+			r := &regionMarkers{name: strings.TrimPrefix(name, loopStartPrefix), isLoop: true, start: m}
+			regions = append(regions, r)
+			stack = append(stack, r)
+		case strings.HasPrefix(name, loopEndPrefix):
+			top, err := closeRegion(strings.TrimPrefix(name, loopEndPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if !top.isLoop {
+				return nil, fmt.Errorf("condition %q ends with a loop marker", top.name)
+			}
+			top.end = m
+		case strings.HasPrefix(name, conditionPrefix):
+			r := &regionMarkers{name: strings.TrimPrefix(name, conditionPrefix), start: m}
+			regions = append(regions, r)
+			stack = append(stack, r)
+		case strings.HasPrefix(name, conditionElsePrefix):
+			name = strings.TrimPrefix(name, conditionElsePrefix)
+			if len(stack) == 0 || stack[len(stack)-1].name != name || stack[len(stack)-1].isLoop {
+				return nil, fmt.Errorf("else marker of condition %q is outside of the condition", name)
+			}
+			top := stack[len(stack)-1]
+			if top.elseMarker != nil {
+				return nil, fmt.Errorf("condition %q has more than one else marker", name)
+			}
+			top.elseMarker = m
+		case strings.HasPrefix(name, conditionEndPrefix):
+			top, err := closeRegion(strings.TrimPrefix(name, conditionEndPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if top.isLoop {
+				return nil, fmt.Errorf("loop %q ends with a condition marker", top.name)
+			}
+			top.end = m
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("region %q is not closed", stack[len(stack)-1].name)
+	}
+	for _, r := range regions {
+		r.owner = commonAncestor(r.start, r.elseMarker, r.end)
+	}
+	return regions, nil
+}
+
+// commonAncestor returns the nearest element enclosing all markers,
+// or the table if that element is a table row.
+func commonAncestor(markers ...*marker) *element {
+	first := markers[0].ancestors
+	depth := 0
+common:
+	for ; depth < len(first); depth++ {
+		for _, m := range markers {
+			if m != nil && (depth >= len(m.ancestors) || m.ancestors[depth] != first[depth]) {
+				break common
+			}
+		}
+	}
+	if depth == 0 {
+		return nil
+	}
+	if first[depth-1].is("tr") && depth >= 2 {
+		return first[depth-2]
+	}
+	return first[depth-1]
+}
+
+// containedIn reports whether node is the marker or one of its ancestors.
+func (m *marker) containedIn(node xml.Token) bool {
+	if f, ok := node.(*field); ok {
+		return f == m.field
+	}
+	for _, a := range m.ancestors {
+		if a == node {
+			return true
+		}
+	}
+	return false
+}
+
+// regionParser groups the children spanned by regions into *loop and *condition values.
+type regionParser struct {
+	regions []*regionMarkers
+}
+
+// nest replaces the regions within nodes, the children of owner.
+func (p *regionParser) nest(nodes []xml.Token, owner *element) ([]xml.Token, error) {
+	var result []xml.Token
+	for i := 0; i < len(nodes); i++ {
+		r := p.startingIn(nodes[i], owner)
+		if r == nil {
+			switch node := nodes[i].(type) {
+			case *element:
+				children, err := p.nest(node.children, node)
+				if err != nil {
+					return nil, err
+				}
+				node.children = children
+			case *loop:
+				// a column loop
+				body, err := p.nest(node.body, owner)
+				if err != nil {
+					return nil, err
+				}
+				node.body = body
+			}
+			result = append(result, nodes[i])
+			continue
+		}
+		j := i
+		for j < len(nodes) && !r.end.containedIn(nodes[j]) {
+			j++
+		}
+		if j == len(nodes) {
+			return nil, fmt.Errorf("end marker of %q not found after its start marker", r.name)
+		}
+		region, sections, err := p.region(r, nodes[i:j+1], owner)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sections[0]...)
+		result = append(result, region)
+		result = append(result, sections[1]...)
+		i = j
+	}
+	return result, nil
+}
+
+// startingIn returns the outermost unprocessed region of owner
+// whose start marker is within node.
+func (p *regionParser) startingIn(node xml.Token, owner *element) *regionMarkers {
+	for _, r := range p.regions {
+		if !r.done && r.owner == owner && r.start.containedIn(node) {
+			r.done = true
+			return r
+		}
+	}
+	return nil
+}
+
+// region creates the *loop or *condition spanning nodes. Marker paragraphs
+// that hold a section break are returned to be kept before and after the
+// region, so the section break is neither repeated nor removed.
+func (p *regionParser) region(r *regionMarkers, nodes []xml.Token, owner *element) (xml.Token, [2][]xml.Token, error) {
+	var sections [2][]xml.Token
+	source := copyTree(nodes)
+	body := append([]xml.Token(nil), nodes...)
+	body, end := removeMarker(body, len(body)-1, r.end)
+	body, start := removeMarker(body, 0, r.start)
+	if start != nil {
+		sections[0] = append(sections[0], start)
+	}
+	if end != nil {
+		sections[1] = append(sections[1], end)
+	}
+
+	if r.isLoop {
+		body, err := p.nest(body, owner)
+		if err != nil {
+			return nil, sections, err
+		}
+		return &loop{name: r.name, start: r.start.field, end: r.end.field, body: body, source: source}, sections, nil
+	}
+
+	c := &condition{name: r.name, start: r.start.field, end: r.end.field, source: source}
+	then := body
+	var otherwise []xml.Token
+	if r.elseMarker != nil {
+		c.elseMarker = r.elseMarker.field
+		k := 0
+		for k < len(body) && !r.elseMarker.containedIn(body[k]) {
+			k++
+		}
+		if k == len(body) || r.start.containedIn(body[k]) || r.end.containedIn(body[k]) {
+			return nil, sections, fmt.Errorf("else marker of condition %q has to be in another paragraph than its start and end marker", r.name)
+		}
+		rest, section := removeMarker(append([]xml.Token(nil), body[k:]...), 0, r.elseMarker)
+		if len(rest) > 0 && r.elseMarker.containedIn(rest[0]) {
+			return nil, sections, fmt.Errorf("else marker of condition %q has to be in a paragraph of its own", r.name)
+		}
+		if section != nil {
+			sections[1] = append([]xml.Token{section}, sections[1]...)
+		}
+		then, otherwise = body[:k], rest
+	}
+	var err error
+	if c.then, err = p.nest(then, owner); err != nil {
+		return nil, sections, err
+	}
+	if c.otherwise, err = p.nest(otherwise, owner); err != nil {
+		return nil, sections, err
+	}
+	return c, sections, nil
+}
+
+// removeMarker removes a marker from nodes[i]. The node is removed as well
+// if it is the marker itself, or a paragraph or table row that holds nothing
+// else. A removed paragraph that holds a section break is returned.
+func removeMarker(nodes []xml.Token, i int, m *marker) ([]xml.Token, xml.Token) {
+	if len(nodes) == 0 || !m.containedIn(nodes[i]) {
+		return nodes, nil
+	}
+	var section xml.Token
+	if el, ok := nodes[i].(*element); ok {
+		parent := m.ancestors[len(m.ancestors)-1]
+		var children []xml.Token
+		for _, c := range parent.children {
+			if c != xml.Token(m.field) {
+				children = append(children, c)
+			}
+		}
+		parent.children = children
+		if !(el.is("p") || el.is("tr")) || hasContent(el.children) {
+			return nodes, nil
+		}
+		if properties := el.child("pPr"); el.is("p") && properties != nil && properties.child("sectPr") != nil {
+			section = el
+		}
+	}
+	return append(nodes[:i:i], nodes[i+1:]...), section
+}
+
+// hasContent reports whether nodes hold text, a placeholder or another visible object.
+func hasContent(nodes []xml.Token) bool {
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *field, *loop, *condition:
+			return true
+		case *element:
+			if node.Name.Space == wordNamespace {
+				switch node.Name.Local {
+				case "t":
+					if node.text() != "" {
+						return true
+					}
+				case "drawing", "pict", "object", "br", "tab", "sym", "fldSimple", "fldChar":
+					return true
+				}
+			}
+			if hasContent(node.children) {
+				return true
+			}
+		}
+	}
+	return false
+}
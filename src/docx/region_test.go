@@ -0,0 +1,238 @@
+package docx_test
+
+import (
+	"docx"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var textPattern = regexp.MustCompile(`<w:t[^>]*>([^<]*)</w:t>`)
+
+// texts returns the content of all <w:t> elements.
+func texts(content string) string {
+	var result []string
+	for _, m := range textPattern.FindAllStringSubmatch(content, -1) {
+		result = append(result, m[1])
+	}
+	return strings.Join(result, "|")
+}
+
+func TestReplaceNestedLoop(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:order»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Order «number»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«start:line»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«number»-«pos»: «article»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:line»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:order»</w:t></w:r></w:p>`)
+
+	orders := []docx.LoopElement{
+		{
+			"number": "A1",
+			"line": []docx.LoopElement{
+				{"pos": "1", "article": "Towel"},
+				{"pos": "2", "article": "Guide"},
+			},
+		},
+		{
+			"number": "B2",
+			"line":   []map[string]string{{"pos": "1", "article": "Fish"}},
+		},
+	}
+	if err := d.ReplaceNestedLoop("order", orders); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Order |A1|A1|-|1|: |Towel|A1|-|2|: |Guide|Order |B2|B2|-|1|: |Fish"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestReplaceLoopKeepsOtherLoops(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:a»</w:t></w:r><w:r><w:t>«x»</w:t></w:r><w:r><w:t>«end:a»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«start:b»</w:t></w:r><w:r><w:t>«x»</w:t></w:r><w:r><w:t>«end:b»</w:t></w:r></w:p>`)
+
+	if err := d.ReplaceLoop("a", []map[string]string{{"x": "1"}, {"x": "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "1|2|«start:b»|«x»|«end:b»"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestReplaceLoopUnbalanced(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:a»</w:t></w:r><w:r><w:t>«start:b»</w:t></w:r><w:r><w:t>«end:a»</w:t></w:r></w:p>`)
+	if err := d.ReplaceLoop("a", nil); err == nil {
+		t.Error("expected an error for crossing loops")
+	}
+}
+
+func TestReplaceCondition(t *testing.T) {
+	body := `<w:p><w:r><w:t>«if:discount»</w:t></w:r><w:r><w:t>You save money.</w:t></w:r>` +
+		`<w:r><w:t>«else:discount»</w:t></w:r><w:r><w:t>Full price.</w:t></w:r><w:r><w:t>«endif:discount»</w:t></w:r></w:p>`
+	for _, test := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{true, "You save money."},
+		{false, "Full price."},
+		{"10%", "You save money."},
+		{"", "Full price."},
+		{[]map[string]string{{"x": "y"}}, "You save money."},
+		{[]docx.LoopElement{}, "Full price."},
+	} {
+		d := newTestDocx(t, body)
+		if err := d.ReplaceCondition("discount", test.value); err != nil {
+			t.Fatal(err)
+		}
+		if actual := texts(d.Content); actual != test.expected {
+			t.Errorf("%#v: expected %q, got %q", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestConditionInLoop(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:p»</w:t></w:r><w:r><w:t>«name»</w:t></w:r>`+
+		`<w:r><w:t>«if:vip»</w:t></w:r><w:r><w:t> (VIP)</w:t></w:r><w:r><w:t>«endif:vip»</w:t></w:r>`+
+		`<w:r><w:t>«end:p»</w:t></w:r></w:p>`)
+
+	err := d.ReplaceNestedLoop("p", []docx.LoopElement{
+		{"name": "Arthur", "vip": false},
+		{"name": "Zaphod", "vip": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Arthur|Zaphod| (VIP)"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestLoopRemovesMarkerParagraphs(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:item»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«name»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:item»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Total</w:t></w:r></w:p>`)
+	if err := d.ReplaceLoop("item", []map[string]string{{"name": "Towel"}, {"name": "Guide"}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<w:body><w:p><w:r><w:t>Towel</w:t></w:r></w:p><w:p><w:r><w:t>Guide</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>Total</w:t></w:r></w:p></w:body>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+}
+
+func TestLoopKeepsSectionBreaks(t *testing.T) {
+	section := `<w:pPr><w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/></w:sectPr></w:pPr>`
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:item»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«name»</w:t></w:r></w:p>`+
+		`<w:p>`+section+`<w:r><w:t>«end:item»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Total</w:t></w:r></w:p>`)
+	if err := d.ReplaceLoop("item", []map[string]string{{"name": "Towel"}, {"name": "Guide"}}); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(d.Content, `w:orient="landscape"`); count != 1 {
+		t.Errorf("expected the section break once, got %d in %s", count, d.Content)
+	}
+	if expected, actual := "Towel|Guide|Total", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if i, j := strings.Index(d.Content, "Guide"), strings.Index(d.Content, "<w:sectPr>"); j < i {
+		t.Errorf("expected the section break after the loop, got %s", d.Content)
+	}
+}
+
+func TestLoopRepeatsTableRow(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Room</w:t></w:r></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:p><w:r><w:t>«start:guest»</w:t></w:r><w:r><w:t>«name»</w:t></w:r></w:p></w:tc>`+
+		`<w:tc><w:p><w:r><w:t>«room»</w:t></w:r><w:r><w:t>«end:guest»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	guests := []map[string]string{{"name": "Arthur", "room": "42"}, {"name": "Ford", "room": "43"}}
+	if err := d.ReplaceLoop("guest", guests); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Name|Room|Arthur|42|Ford|43", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if count := strings.Count(d.Content, "<w:tr>"); count != 3 {
+		t.Errorf("expected 3 rows, got %d in %s", count, d.Content)
+	}
+}
+
+func TestLoopInCellWithoutElements(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:tcPr><w:tcW w:w="2000" w:type="dxa"/></w:tcPr>`+
+		`<w:p><w:r><w:t>«start:item»</w:t></w:r></w:p><w:p><w:r><w:t>«name»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:item»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	if err := d.ReplaceLoop("item", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d.Content, `</w:tcPr><w:p></w:p></w:tc>`) {
+		t.Errorf("expected an empty paragraph in the cell, got %s", d.Content)
+	}
+}
+
+func TestLoopRemovesMarkerRows(t *testing.T) {
+	d := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«start:guest»</w:t></w:r></w:p></w:tc><w:tc><w:p></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:p><w:r><w:t>«name»</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>«room»</w:t></w:r></w:p></w:tc></w:tr>`+
+		`<w:tr><w:tc><w:p><w:r><w:t>«end:guest»</w:t></w:r></w:p></w:tc><w:tc><w:p></w:p></w:tc></w:tr></w:tbl>`)
+	guests := []map[string]string{{"name": "Arthur", "room": "42"}, {"name": "Ford", "room": "43"}}
+	if err := d.ReplaceLoop("guest", guests); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Arthur|42|Ford|43", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if count := strings.Count(d.Content, "<w:tr>"); count != 2 {
+		t.Errorf("expected 2 rows, got %d in %s", count, d.Content)
+	}
+}
+
+func TestLoopAcrossNestingDepths(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:section»</w:t></w:r><w:r><w:t>«title»</w:t></w:r></w:p>`+
+		`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«text»</w:t></w:r><w:r><w:t>«end:section»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`+
+		`<w:p><w:r><w:t>End</w:t></w:r></w:p>`)
+	sections := []map[string]string{{"title": "One", "text": "1"}, {"title": "Two", "text": "2"}}
+	if err := d.ReplaceLoop("section", sections); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<w:p><w:r><w:t>One</w:t></w:r></w:p><w:tbl><w:tr><w:tc><w:p><w:r><w:t>1</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+		`<w:p><w:r><w:t>Two</w:t></w:r></w:p><w:tbl><w:tr><w:tc><w:p><w:r><w:t>2</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+		`<w:p><w:r><w:t>End</w:t></w:r></w:p>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+}
+
+func TestConditionRemovesMarkerParagraphs(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«if:paid»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Thank you.</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«else:paid»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Please pay.</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«endif:paid»</w:t></w:r></w:p>`)
+	if err := d.ReplaceCondition("paid", false); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<w:body><w:p><w:r><w:t>Please pay.</w:t></w:r></w:p></w:body>`; !strings.Contains(d.Content, expected) {
+		t.Errorf("expected %s in %s", expected, d.Content)
+	}
+}
+
+func TestLoopMetadata(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:p»</w:t></w:r>`+
+		`<w:r><w:t>«#number»/«#count» «name»</w:t></w:r>`+
+		`<w:r><w:t>«if:#odd»</w:t></w:r><w:r><w:t> odd</w:t></w:r><w:r><w:t>«endif:#odd»</w:t></w:r>`+
+		`<w:r><w:t>«if:#last»</w:t></w:r><w:r><w:t>.</w:t></w:r><w:r><w:t>«else:#last»</w:t></w:r><w:r><w:t>, </w:t></w:r><w:r><w:t>«endif:#last»</w:t></w:r>`+
+		`<w:r><w:t>«end:p»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«#index»</w:t></w:r></w:p>`)
+	people := []map[string]string{{"name": "Arthur"}, {"name": "Ford"}, {"name": "Zaphod"}}
+	if err := d.ReplaceLoop("p", people); err != nil {
+		t.Fatal(err)
+	}
+	expected := "1|/|3| |Arthur| odd|, |2|/|3| |Ford|, |3|/|3| |Zaphod| odd|.|«#index»"
+	if actual := texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
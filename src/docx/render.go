@@ -0,0 +1,450 @@
+package docx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"xml"
+)
+
+// LoopElement holds the values of a single loop iteration.
+// A value is either a string or a []LoopElement holding the
+// elements of a nested loop.
+type LoopElement map[string]interface{}
+
+// render replaces the placeholders, loops and conditions of the selected story parts with the given data.
+func (d *Docx) render(data interface{}, options RenderOptions) error {
+	names, err := d.selectParts(options.Parts)
+	if err != nil {
+		return err
+	}
+	templates := make(map[string][]xml.Token)
+	for _, name := range names {
+		if templates[name], err = parsePart(d.part(name)); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return d.renderTemplates(context.Background(), names, templates, data, options)
+}
+
+// renderTemplates renders the parsed templates of the named story parts.
+// The templates are not changed, so they can be rendered again.
+func (d *Docx) renderTemplates(ctx context.Context, names []string, templates map[string][]xml.Token, data interface{}, options RenderOptions) error {
+	locale, err := lookupLocale(options.Locale)
+	if err != nil {
+		return err
+	}
+	r := newRenderer(options)
+	r.ctx, r.docx, r.locale = ctx, d, locale
+	backup := copyFiles(d.changed)
+	contents := make(map[string]string)
+	for _, name := range names {
+		r.part = name
+		content, err := r.renderPart(templates[name], &scope{data: data})
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			d.changed = backup
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		contents[name] = content
+	}
+	var properties map[string][]byte
+	if len(options.Parts) == 0 {
+		r.part = ""
+		if properties, err = r.renderProperties(data); err == nil {
+			err = r.err
+		}
+		if err != nil {
+			d.changed = backup
+			return err
+		}
+	}
+	if options.Strict {
+		if err := r.check(data); err != nil {
+			d.changed = backup
+			return err
+		}
+	}
+	for name, content := range contents {
+		d.setPart(name, content)
+	}
+	for name, content := range properties {
+		d.setFile(name, content)
+	}
+	return nil
+}
+
+// parsePart parses the content of a single story part into a template.
+func parsePart(content string) ([]xml.Token, error) {
+	content, err := mergePlaceholderRuns(content)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := readTokens(content)
+	if err != nil {
+		return nil, err
+	}
+	return parseTemplate(stripIgnorable(tokens))
+}
+
+// renderPart renders the template of a single story part within the given scope.
+func (r *renderer) renderPart(nodes []xml.Token, s *scope) (string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	encoder := newEncoder(&buf)
+	if err := encodeTree(encoder, r.render(nodes, s)); err != nil {
+		return "", err
+	}
+	encoder.Flush()
+	return buf.String(), nil
+}
+
+// stripIgnorable removes the "Ignorable" attribute from the root element
+// (e.g. <document/>).
+//
+// WORKAROUND: The genereated document.xml is not fully valid
+// however, MS Word manages to open it with a warning.
+// In order to circumvent the warning, we have to skip the attribute "Ignorable"
+func stripIgnorable(tokens []xml.Token) []xml.Token {
+	for i, t := range tokens {
+		node, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var newAttr []xml.Attr
+		for _, attr := range node.Attr {
+			if strings.ToLower(attr.Name.Local) != "ignorable" {
+				newAttr = append(newAttr, attr)
+			}
+		}
+		node.Attr = newAttr
+		tokens[i] = node
+		break
+	}
+	return tokens
+}
+
+// renderer renders parsed templates and keeps track
+// of the data that is missing or used.
+type renderer struct {
+	options RenderOptions
+	errors  RenderError
+	missing map[string]bool
+	used    map[string]bool
+
+	ctx    context.Context // cancels the render between loop iterations
+	locale *Locale
+	docx   *Docx  // package that media and relationships are added to
+	part   string // name of the part that is rendered
+	err    error  // first error that prevents the render, e.g. an invalid image
+}
+
+func newRenderer(options RenderOptions) *renderer {
+	return &renderer{options: options, missing: make(map[string]bool), used: make(map[string]bool), ctx: context.Background()}
+}
+
+// lookup resolves a name and remembers the data as used.
+func (r *renderer) lookup(s *scope, name string) (interface{}, bool) {
+	v, path, ok := s.lookup(name)
+	if !ok {
+		return nil, false
+	}
+	for path != "" {
+		r.used[strings.ToLower(path)] = true
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return v, true
+}
+
+// addMissing remembers a name without data once.
+func (r *renderer) addMissing(list *[]string, s *scope, name string) {
+	path := joinPath(s.path, name)
+	if r.missing[path] {
+		return
+	}
+	r.missing[path] = true
+	*list = append(*list, path)
+}
+
+// check returns a *RenderError if the template has not been
+// rendered completely or if some of the data has not been used.
+func (r *renderer) check(data interface{}) error {
+	dataKeys(reflect.ValueOf(data), "", func(path string) {
+		parent := ""
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			parent = path[:i]
+		}
+		if !r.used[strings.ToLower(path)] && (parent == "" || r.used[strings.ToLower(parent)]) {
+			r.errors.UnusedData = append(r.errors.UnusedData, path)
+		}
+	})
+	sort.Strings(r.errors.UnusedData)
+	if r.errors.empty() {
+		return nil
+	}
+	return &r.errors
+}
+
+// render renders a parsed template within the given scope.
+func (r *renderer) render(nodes []xml.Token, s *scope) []xml.Token {
+	var result []xml.Token
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *field:
+			v, ok := r.lookup(s, node.name)
+			if !ok && node.hasDefault() {
+				v, ok = nil, true
+			}
+			if ok && (len(node.format) > 0 || node.formatErr != nil) {
+				var err error
+				if v, err = r.format(node, v); err != nil {
+					if r.err == nil {
+						r.err = err
+					}
+					result = append(result, node.raw()...)
+					continue
+				}
+			}
+			if _, isCollection := collection(v); !ok || isCollection || isStream(v) {
+				r.addMissing(&r.errors.MissingPlaceholders, s, node.name)
+				result = append(result, r.missingField(node)...)
+				continue
+			}
+			if tokens, ok := r.renderObject(node, v); ok {
+				result = append(result, tokens...)
+				continue
+			}
+			result = append(result, node.render(valueText(v))...)
+		case *loop:
+			items, ok := r.loopElements(node, s)
+			if !ok {
+				if r.options.Missing != BlankMissing {
+					result = append(result, node.raw()...)
+				}
+				continue
+			}
+			path := joinPath(s.path, node.name)
+			items.each(func(item interface{}, position *loopPosition) bool {
+				if r.canceled() {
+					return false
+				}
+				result = append(result, r.render(node.body, &scope{data: item, path: path, parent: s, loop: position})...)
+				return true
+			})
+		case *condition:
+			if branch, ok := r.branch(node, s); ok {
+				result = append(result, r.render(branch, s)...)
+			} else {
+				result = append(result, node.raw()...)
+			}
+		case *element:
+			el := &element{StartElement: node.StartElement.Copy(), children: r.render(node.children, s)}
+			if isEmptyCell(el) {
+				el.children = append(el.children, newWordElement("p"))
+			}
+			if hasColumnLoops(node) {
+				fitTableWidth(el)
+			}
+			result = append(result, el)
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// isEmptyCell reports whether e is a table cell without paragraphs, tables
+// or other content, e.g. after a loop without elements. Word reports such
+// cells as corrupt.
+func isEmptyCell(e *element) bool {
+	if !e.is("tc") {
+		return false
+	}
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok && !el.is("tcPr") {
+			return false
+		}
+	}
+	return true
+}
+
+// loopElements returns the data of a loop, or false if there is none.
+func (r *renderer) loopElements(l *loop, s *scope) (*sequence, bool) {
+	v, ok := r.lookup(s, l.name)
+	items, isCollection := elements(v)
+	if !ok || !isCollection {
+		r.addMissing(&r.errors.MissingLoops, s, l.name)
+		return nil, false
+	}
+	return items, true
+}
+
+// branch returns the part of a condition that is rendered,
+// or false if the condition is kept as it is because it has no data.
+func (r *renderer) branch(c *condition, s *scope) ([]xml.Token, bool) {
+	v, ok := r.lookup(s, c.name)
+	if !ok {
+		r.addMissing(&r.errors.MissingConditions, s, c.name)
+		if r.options.Missing != BlankMissing {
+			return nil, false
+		}
+	}
+	if isTrue(v) {
+		return c.then, true
+	}
+	return c.otherwise, true
+}
+
+// canceled reports whether the context of the render is done.
+func (r *renderer) canceled() bool {
+	err := r.ctx.Err()
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return err != nil
+}
+
+// missingField renders a placeholder without data.
+func (r *renderer) missingField(f *field) []xml.Token {
+	switch r.options.Missing {
+	case BlankMissing:
+		return nil
+	case HighlightMissing:
+		if f.run != nil {
+			color := r.options.HighlightColor
+			if color == "" {
+				color = "yellow"
+			}
+			return []xml.Token{highlight(f.run.copy(), color)}
+		}
+	}
+	return f.raw()
+}
+
+// runPropertiesAfterHighlight are the run properties that follow
+// <w:highlight> in the sequence of CT_RPr.
+var runPropertiesAfterHighlight = map[string]bool{
+	"u": true, "effect": true, "bdr": true, "shd": true, "fitText": true, "vertAlign": true, "rtl": true,
+	"cs": true, "em": true, "lang": true, "eastAsianLayout": true, "specVanish": true, "oMath": true,
+	"rPrChange": true,
+}
+
+// highlight adds a highlight color to the properties of a run,
+// at its position in the order of the schema.
+func highlight(run *element, color string) *element {
+	props := run.child("rPr")
+	if props == nil {
+		props = newWordElement("rPr")
+		run.children = append([]xml.Token{props}, run.children...)
+	}
+	value := xml.Attr{Name: xml.Name{Space: wordNamespace, Local: "val"}, Value: color}
+	var children []xml.Token
+	added := false
+	for _, c := range props.children {
+		el, ok := c.(*element)
+		if ok && el.is("highlight") {
+			continue
+		}
+		if ok && !added && el.Name.Space == wordNamespace && runPropertiesAfterHighlight[el.Name.Local] {
+			children = append(children, newWordElement("highlight", value))
+			added = true
+		}
+		children = append(children, c)
+	}
+	if !added {
+		children = append(children, newWordElement("highlight", value))
+	}
+	props.children = children
+	return run
+}
+
+// renderObject renders the values that are more than text: images and hyperlinks.
+func (r *renderer) renderObject(f *field, v interface{}) ([]xml.Token, bool) {
+	var tokens []xml.Token
+	var err error
+	if img, ok := imageValue(v); ok {
+		tokens, err = r.renderImage(f, img)
+	} else if link, ok := hyperlinkValue(v); ok {
+		tokens, err = r.renderHyperlink(f, link)
+	} else {
+		return nil, false
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return tokens, true
+}
+
+// valueText returns the text a value is rendered as.
+func valueText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// raw returns the field as it has been in the template.
+func (f *field) raw() []xml.Token {
+	if f.original != nil {
+		return rawNodes(f.original)
+	}
+	if f.run != nil {
+		return []xml.Token{f.run}
+	}
+	return []xml.Token{f.text}
+}
+
+// render returns the field with its placeholder replaced by value.
+func (f *field) render(value string) []xml.Token {
+	if f.run == nil {
+		return []xml.Token{xml.CharData(value)}
+	}
+	run := f.run.copy()
+	for i, c := range run.children {
+		if el, ok := c.(*element); ok && el.is("t") {
+			run.children[i] = newTextElement(value)
+		}
+	}
+	return []xml.Token{run}
+}
+
+// raw returns the loop as it has been in the template.
+func (l *loop) raw() []xml.Token {
+	return rawNodes(l.source)
+}
+
+// raw returns the condition as it has been in the template.
+func (c *condition) raw() []xml.Token {
+	return rawNodes(c.source)
+}
+
+// rawNodes returns a parsed template as it has been before parsing.
+func rawNodes(nodes []xml.Token) []xml.Token {
+	var result []xml.Token
+	for _, n := range nodes {
+		switch node := n.(type) {
+		case *field:
+			result = append(result, node.raw()...)
+		case *loop:
+			result = append(result, node.raw()...)
+		case *condition:
+			result = append(result, node.raw()...)
+		case *element:
+			result = append(result, &element{StartElement: node.StartElement.Copy(), children: rawNodes(node.children)})
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
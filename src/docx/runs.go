@@ -0,0 +1,302 @@
+package docx
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"xml"
+)
+
+// runBarrier separates text that a placeholder must not span,
+// e.g. the text of a hyperlink between two runs.
+const runBarrier = "\x00"
+
+var placeholderPattern = regexp.MustCompile(mergeFieldOpenTag + "[^" + mergeFieldOpenTag + mergeFieldCloseTag + runBarrier + "]*" + mergeFieldCloseTag)
+
+// textPiece is the text of a single <w:t> element within a paragraph.
+type textPiece struct {
+	start int // offset in the logical paragraph text
+	text  string
+}
+
+// mergePlaceholderRuns makes sure that every placeholder in the given
+// WordprocessingML part sits in a run of its own.
+//
+// Word often splits a typed «placeholder» into several runs (spell checking,
+// revision ids, partial formatting). The placeholders are found by the
+// logical text of their paragraph and merged into a single run that keeps
+// the formatting of the run holding the opening tag.
+// Paragraphs without split placeholders are left untouched.
+func mergePlaceholderRuns(content string) (string, error) {
+	var result strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	var paragraph []xml.Token
+	// the prefixes declared by the ancestors of the paragraphs
+	scopes := []namespaceScope{nil}
+	var paragraphStart, last int64
+	depth := 0
+	changed := false
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return content, err
+		}
+
+		switch node := t.(type) {
+		case xml.StartElement:
+			if node.Name.Space == wordNamespace && node.Name.Local == "p" {
+				if depth == 0 {
+					paragraphStart = offset
+				}
+				depth++
+			} else if depth == 0 {
+				_, inner := scopes[len(scopes)-1].declare(node)
+				scopes = append(scopes, inner)
+			}
+		case xml.EndElement:
+			if node.Name.Space != wordNamespace || node.Name.Local != "p" {
+				if depth == 0 {
+					scopes = scopes[:len(scopes)-1]
+				}
+			} else {
+				depth--
+				if depth == 0 {
+					paragraph = append(paragraph, t)
+					tree := buildTree(paragraph)
+					paragraph = nil
+					if !mergeRuns(tree) {
+						continue
+					}
+					var buf bytes.Buffer
+					encoder := newEncoder(&buf)
+					if err := encodeTreeIn(encoder, tree, scopes[len(scopes)-1]); err != nil {
+						return content, err
+					}
+					encoder.Flush()
+					result.WriteString(content[last:paragraphStart])
+					result.Write(buf.Bytes())
+					last = decoder.InputOffset()
+					changed = true
+					continue
+				}
+			}
+		}
+		if depth > 0 {
+			paragraph = append(paragraph, xml.CopyToken(t))
+		}
+	}
+	if !changed {
+		return content, nil
+	}
+	result.WriteString(content[last:])
+	return result.String(), nil
+}
+
+// mergeRuns merges split placeholders in all run containers of the tree.
+// It reports whether the tree has been changed.
+func mergeRuns(nodes []xml.Token) bool {
+	changed := false
+	for _, n := range nodes {
+		el, ok := n.(*element)
+		if !ok {
+			continue
+		}
+		if mergeRuns(el.children) {
+			changed = true
+		}
+		if el.child("r") != nil && mergeContainerRuns(el) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// mergeContainerRuns merges split placeholders between the runs that
+// are direct children of el (a paragraph, hyperlink, ...).
+func mergeContainerRuns(el *element) bool {
+	var logical strings.Builder
+	pieces := make(map[*element]textPiece)
+	for _, c := range el.children {
+		child, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		if !child.is("r") {
+			if child.hasText() {
+				logical.WriteString(runBarrier)
+			}
+			continue
+		}
+		for _, rc := range child.children {
+			item, ok := rc.(*element)
+			if !ok {
+				continue
+			}
+			if item.is("t") {
+				piece := textPiece{start: logical.Len(), text: item.text()}
+				pieces[item] = piece
+				logical.WriteString(piece.text)
+			} else if item.hasText() {
+				logical.WriteString(runBarrier)
+			}
+		}
+	}
+
+	text := logical.String()
+	spans := placeholderPattern.FindAllStringIndex(text, -1)
+	if len(spans) == 0 || isMerged(el, pieces, spans) {
+		return false
+	}
+
+	var children []xml.Token
+	for _, c := range el.children {
+		run, ok := c.(*element)
+		if !ok || !run.is("r") || !hasPlaceholderText(run, pieces, spans) {
+			children = append(children, c)
+			continue
+		}
+		children = append(children, splitRun(run, pieces, spans, text)...)
+	}
+	el.children = children
+	return true
+}
+
+// isMerged reports whether every placeholder already is the only text of its run.
+func isMerged(el *element, pieces map[*element]textPiece, spans [][]int) bool {
+	runOf := make(map[*element]*element)
+	for _, c := range el.children {
+		if run, ok := c.(*element); ok && run.is("r") {
+			for _, rc := range run.children {
+				if item, ok := rc.(*element); ok {
+					runOf[item] = run
+				}
+			}
+		}
+	}
+	for _, span := range spans {
+		merged := false
+		for item, piece := range pieces {
+			if piece.start == span[0] && len(piece.text) == span[1]-span[0] {
+				merged = isPlaceholderRun(runOf[item])
+				break
+			}
+		}
+		if !merged {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPlaceholderText reports whether some text of the run belongs to a placeholder.
+func hasPlaceholderText(run *element, pieces map[*element]textPiece, spans [][]int) bool {
+	for _, c := range run.children {
+		item, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		piece, ok := pieces[item]
+		if !ok {
+			continue
+		}
+		for _, span := range spans {
+			if span[0] < piece.start+len(piece.text) && span[1] > piece.start {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPlaceholderRun reports whether the run consists of its properties
+// and a single <w:t> element.
+func isPlaceholderRun(run *element) bool {
+	texts := 0
+	for _, c := range run.children {
+		item, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		switch {
+		case item.is("t"):
+			texts++
+		case !item.is("rPr"):
+			return false
+		}
+	}
+	return texts == 1
+}
+
+// splitRun splits a run at the placeholder boundaries. A placeholder that starts
+// in this run is emitted as a run of its own, placeholder text belonging to a
+// placeholder that started in a previous run is dropped.
+func splitRun(run *element, pieces map[*element]textPiece, spans [][]int, text string) []xml.Token {
+	props := run.child("rPr")
+	newRun := func() *element {
+		r := &element{StartElement: run.StartElement.Copy()}
+		if props != nil {
+			r.children = append(r.children, props.copy())
+		}
+		return r
+	}
+
+	var result []xml.Token
+	current := newRun()
+	hasContent := false
+	flush := func() {
+		if hasContent {
+			result = append(result, current)
+		}
+		current = newRun()
+		hasContent = false
+	}
+	addText := func(s string) {
+		if s != "" {
+			current.children = append(current.children, newTextElement(s))
+			hasContent = true
+		}
+	}
+
+	for _, c := range run.children {
+		item, ok := c.(*element)
+		if !ok {
+			continue
+		}
+		if item.is("rPr") {
+			continue
+		}
+		piece, ok := pieces[item]
+		if !ok {
+			current.children = append(current.children, item)
+			hasContent = true
+			continue
+		}
+		start, end := piece.start, piece.start+len(piece.text)
+		cursor := start
+		for _, span := range spans {
+			if span[1] <= start || span[0] >= end {
+				continue
+			}
+			if span[0] > cursor {
+				addText(text[cursor:span[0]])
+			}
+			if span[0] >= start {
+				flush()
+				placeholder := newRun()
+				placeholder.children = append(placeholder.children, newTextElement(text[span[0]:span[1]]))
+				result = append(result, placeholder)
+			}
+			cursor = span[1]
+		}
+		if cursor < end {
+			addText(text[cursor:end])
+		}
+	}
+	flush()
+	return result
+}
@@ -0,0 +1,58 @@
+package docx_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceSplitPlaceholder(t *testing.T) {
+	d := newTestDocx(t, `<w:p>`+
+		`<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Dear «Cust</w:t></w:r>`+
+		`<w:proofErr w:type="spellStart"/>`+
+		`<w:r w:rsidR="00AB"><w:rPr><w:i/></w:rPr><w:t>omer</w:t></w:r>`+
+		`<w:proofErr w:type="spellEnd"/>`+
+		`<w:r><w:t>Name», welcome</w:t></w:r>`+
+		`</w:p>`)
+
+	if err := d.Replace("CustomerName", "Jane Doe", -1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(d.Content, "«") || strings.Contains(d.Content, "omer") {
+		t.Fatalf("placeholder has not been replaced: %s", d.Content)
+	}
+	expected := `<w:r><w:rPr><w:b></w:b></w:rPr><w:t>Jane Doe</w:t></w:r>`
+	if !strings.Contains(d.Content, expected) {
+		t.Errorf("expected the replaced run to keep the first run's properties %s, got %s", expected, d.Content)
+	}
+	if !strings.Contains(d.Content, `<w:t xml:space="preserve">Dear </w:t>`) || !strings.Contains(d.Content, `<w:t>, welcome</w:t>`) {
+		t.Errorf("expected the surrounding text to be kept, got %s", d.Content)
+	}
+}
+
+func TestReplaceLoopSplitMarkers(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«start:</w:t></w:r><w:r><w:t>item»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«na</w:t></w:r><w:r><w:t>me»</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>«end:item»</w:t></w:r></w:p>`)
+
+	err := d.ReplaceLoop("item", []map[string]string{{"name": "first"}, {"name": "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(d.Content, "«") {
+		t.Fatalf("loop has not been replaced: %s", d.Content)
+	}
+	if !strings.Contains(d.Content, "first") || !strings.Contains(d.Content, "second") {
+		t.Errorf("expected both loop elements, got %s", d.Content)
+	}
+}
+
+func TestReplaceKeepsUnsplitContent(t *testing.T) {
+	body := `<w:p><w:r><w:t>No placeholder here</w:t></w:r></w:p><w:p><w:r><w:t>«x»</w:t></w:r></w:p>`
+	d := newTestDocx(t, body)
+	if err := d.Replace("y", "z", -1); err != nil {
+		t.Fatal(err)
+	}
+	if d.Content != testDocumentStart+body+testDocumentEnd {
+		t.Errorf("expected content to be unchanged, got %s", d.Content)
+	}
+}
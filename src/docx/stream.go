@@ -0,0 +1,166 @@
+package docx
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"xml"
+)
+
+// streamRender is a render of story parts that is done when the docx is written.
+type streamRender struct {
+	data      interface{}
+	options   RenderOptions
+	locale    *Locale
+	names     []string               // story parts that are rendered
+	templates map[string][]xml.Token // parsed story parts by name
+	contents  map[string]string      // the story parts as they have been parsed, to find later changes
+	written   bool
+}
+
+// StreamRender works like RenderWithOptions, but the story parts are rendered
+// when the docx is written, straight into the zip archive. Loops may iterate
+// channels and iterator functions like iter.Seq, e.g. rows read from a database
+// cursor, which are received one element at a time. So the memory needed does
+// not grow with the number of rows. Until the docx is written, Content and
+// Parts keep the template.
+// The elements of channels and iterators can only be received once, so a
+// docx rendered by StreamRender can only be written once, and Write fails
+// if the rendered story parts have been changed since, e.g. by Replace or
+// Render. «#count» is not
+// known for them. The Strict option is not supported, because the missing
+// data is only known after the docx has been written, and errors of the
+// render are returned by Write.
+func (d *Docx) StreamRender(data interface{}, options RenderOptions) error {
+	if options.Strict {
+		return errors.New("strict rendering is not supported by StreamRender")
+	}
+	names, err := d.selectParts(options.Parts)
+	if err != nil {
+		return err
+	}
+	locale, err := lookupLocale(options.Locale)
+	if err != nil {
+		return err
+	}
+	stream := &streamRender{data: data, options: options, locale: locale, names: names,
+		templates: make(map[string][]xml.Token), contents: make(map[string]string)}
+	for _, name := range names {
+		stream.contents[name] = d.part(name)
+		if stream.templates[name], err = parsePart(d.part(name)); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if len(options.Parts) == 0 {
+		r := newRenderer(options)
+		r.docx, r.locale = d, locale
+		properties, err := r.renderProperties(data)
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			return err
+		}
+		for name, content := range properties {
+			d.setFile(name, content)
+		}
+	}
+	d.stream = stream
+	return nil
+}
+
+// contains reports whether a story part is rendered by the stream.
+func (s *streamRender) contains(name string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.templates[name]
+	return ok
+}
+
+// writeStream renders the story parts of a StreamRender into the zip archive.
+func (d *Docx) writeStream(w *zip.Writer) error {
+	if d.stream == nil {
+		return nil
+	}
+	if d.stream.written {
+		return errors.New("a docx rendered by StreamRender can only be written once")
+	}
+	for _, name := range d.stream.names {
+		if d.part(name) != d.stream.contents[name] {
+			return fmt.Errorf("%s has been changed after StreamRender", name)
+		}
+	}
+	d.stream.written = true
+	r := newRenderer(d.stream.options)
+	r.docx, r.locale = d, d.stream.locale
+	for _, file := range d.files {
+		if !d.stream.contains(file.Name) {
+			continue
+		}
+		writer, err := w.CreateHeader(changedHeader(file))
+		if err != nil {
+			return err
+		}
+		r.part = file.Name
+		encoder := newEncoder(writer)
+		if err = r.stream(encoder, d.stream.templates[file.Name], &scope{data: d.stream.data}, nil); err == nil {
+			err = encoder.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// stream renders a parsed template like render, but writes it to the
+// encoder at once. Loops are written one element at a time. The ancestors
+// of the nodes declare the given namespace prefixes.
+func (r *renderer) stream(encoder *xml.Encoder, nodes []xml.Token, s *scope, declared namespaceScope) error {
+	for _, n := range nodes {
+		var err error
+		switch node := n.(type) {
+		case *element:
+			if node.is("tc") || hasColumnLoops(node) {
+				// cells may end up empty, and the width of tables depends on their columns
+				err = encodeTreeIn(encoder, r.render([]xml.Token{n}, s), declared)
+				break
+			}
+			start, inner := declared.declare(node.StartElement)
+			if err = encoder.EncodeToken(start); err == nil {
+				if err = r.stream(encoder, node.children, s, inner); err == nil {
+					err = encoder.EncodeToken(node.End())
+				}
+			}
+		case *loop:
+			items, ok := r.loopElements(node, s)
+			if !ok {
+				if r.options.Missing != BlankMissing {
+					err = encodeTreeIn(encoder, node.raw(), declared)
+				}
+				break
+			}
+			path := joinPath(s.path, node.name)
+			items.each(func(item interface{}, position *loopPosition) bool {
+				err = r.stream(encoder, node.body, &scope{data: item, path: path, parent: s, loop: position}, declared)
+				return err == nil
+			})
+		case *condition:
+			if branch, ok := r.branch(node, s); ok {
+				err = r.stream(encoder, branch, s, declared)
+			} else {
+				err = encodeTreeIn(encoder, node.raw(), declared)
+			}
+		default:
+			err = encodeTreeIn(encoder, r.render([]xml.Token{n}, s), declared)
+		}
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
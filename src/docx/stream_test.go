@@ -0,0 +1,104 @@
+package docx_test
+
+import (
+	"bytes"
+	"docx"
+	"iter"
+	"strings"
+	"testing"
+)
+
+const streamTable = `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>«start:rows»</w:t></w:r></w:p></w:tc></w:tr>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>«#number»</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>«amount»</w:t></w:r></w:p></w:tc>` +
+	`<w:tc><w:p><w:r><w:t>«if:#last»</w:t></w:r><w:r><w:t>last</w:t></w:r><w:r><w:t>«endif:#last»</w:t></w:r></w:p></w:tc></w:tr>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>«end:rows»</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`
+
+// transactions returns an iterator over n rows.
+func transactions(n int) iter.Seq[map[string]int] {
+	return func(yield func(map[string]int) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield(map[string]int{"amount": i * 10}) {
+				return
+			}
+		}
+	}
+}
+
+func TestStreamRender(t *testing.T) {
+	rows := make(chan map[string]int)
+	go func() {
+		for row := range transactions(3) {
+			rows <- row
+		}
+		close(rows)
+	}()
+	for name, data := range map[string]interface{}{
+		"iterator": transactions(3),
+		"channel":  (<-chan map[string]int)(rows),
+	} {
+		d := newTestDocx(t, `<w:p><w:r><w:t>«title»</w:t></w:r></w:p>`+streamTable)
+		if err := d.StreamRender(map[string]interface{}{"title": "Statement", "rows": data}, docx.RenderOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(d.Content, "«start:rows»") {
+			t.Errorf("%s: expected the content to be rendered when written, got %s", name, d.Content)
+		}
+		expected := "Statement|1|10|2|20|3|30|last"
+		if actual := texts(writtenFiles(t, d)["word/document.xml"]); actual != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestStreamRenderWritesOnce(t *testing.T) {
+	d := newTestDocx(t, streamTable)
+	if err := d.StreamRender(map[string]interface{}{"rows": transactions(3)}, docx.RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	writtenFiles(t, d)
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err == nil || !strings.Contains(err.Error(), "only be written once") {
+		t.Errorf("expected an error for the second write, got %v", err)
+	}
+}
+
+func TestStreamRenderRejectsLaterChanges(t *testing.T) {
+	d := newTestDocx(t, `<w:p><w:r><w:t>«title»</w:t></w:r></w:p>`+streamTable)
+	if err := d.StreamRender(map[string]interface{}{"rows": transactions(3)}, docx.RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Render(map[string]interface{}{"title": "Statement"}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err == nil || !strings.Contains(err.Error(), "changed after StreamRender") {
+		t.Errorf("expected an error for the change after StreamRender, got %v", err)
+	}
+}
+
+func TestStreamRenderManyRows(t *testing.T) {
+	d := newTestDocx(t, streamTable)
+	if err := d.StreamRender(map[string]interface{}{"rows": transactions(20000)}, docx.RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	content := writtenFiles(t, d)["word/document.xml"]
+	if count := strings.Count(content, "<w:tr>"); count != 20000 {
+		t.Errorf("expected 20000 rows, got %d", count)
+	}
+	if !strings.HasSuffix(texts(content), "|20000|200000|last") {
+		t.Errorf("expected the last row to be marked, got %s", content[len(content)-500:])
+	}
+}
+
+func TestRenderIterator(t *testing.T) {
+	d := newTestDocx(t, streamTable)
+	if err := d.Render(map[string]interface{}{"rows": transactions(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "1|10|2|20|last", texts(d.Content); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if err := d.StreamRender(nil, docx.RenderOptions{Strict: true}); err == nil {
+		t.Error("expected an error for a strict stream render")
+	}
+}
@@ -0,0 +1,78 @@
+package docx
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"xml"
+)
+
+// Template is a docx that has been parsed once to be rendered many times,
+// e.g. by a service rendering letters. Rendering does not change the
+// template, so Render may be called by several goroutines at once.
+type Template struct {
+	files     []*zip.File
+	content   string
+	parts     map[string]string
+	options   RenderOptions
+	locale    *Locale
+	names     []string               // story parts that are rendered
+	templates map[string][]xml.Token // parsed story parts by name
+}
+
+// NewTemplate parses the story parts of r that are selected by the options.
+// The template reads the unchanged parts from r when a rendered docx is
+// written, so r must not be closed as long as the template is used.
+func NewTemplate(r *ReplaceDocx, options RenderOptions) (*Template, error) {
+	locale, err := lookupLocale(options.Locale)
+	if err != nil {
+		return nil, err
+	}
+	d := r.Editable()
+	names, err := d.selectParts(options.Parts)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{
+		files:     r.files,
+		content:   r.content,
+		parts:     r.parts,
+		options:   options,
+		locale:    locale,
+		names:     names,
+		templates: make(map[string][]xml.Token),
+	}
+	for _, name := range names {
+		if t.templates[name], err = parsePart(d.part(name)); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return t, nil
+}
+
+// Render renders the template with the given data into a new docx, like
+// RenderWithOptions with the options of the template. The render stops
+// with the error of ctx when ctx is done.
+func (t *Template) Render(ctx context.Context, data interface{}) (*Docx, error) {
+	d := t.newDocx()
+	if err := d.renderTemplates(ctx, t.names, t.templates, data, t.options); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newDocx returns a docx holding the unrendered template.
+func (t *Template) newDocx() *Docx {
+	parts := make(map[string]string)
+	for name, content := range t.parts {
+		parts[name] = content
+	}
+	return &Docx{files: t.files, Content: t.content, Parts: parts}
+}
+
+// newRenderer returns a renderer for the options of the template.
+func (t *Template) newRenderer(ctx context.Context, d *Docx) *renderer {
+	r := newRenderer(t.options)
+	r.ctx, r.docx, r.locale = ctx, d, t.locale
+	return r
+}
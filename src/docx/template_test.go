@@ -0,0 +1,71 @@
+package docx_test
+
+import (
+	"context"
+	"docx"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTemplateRenderConcurrently(t *testing.T) {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart +
+			`<w:p><w:r><w:t>Dear «name»,</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«start:items»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«title|upper»</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>«end:items»</w:t></w:r></w:p>` + testDocumentEnd,
+	})
+	template, err := docx.NewTemplate(r, docx.RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("Reader %d", i)
+			data := map[string]interface{}{
+				"name":  name,
+				"items": []map[string]string{{"title": "towel"}, {"title": fmt.Sprint("guide ", i)}},
+			}
+			d, err := template.Render(context.Background(), data)
+			if err != nil {
+				errs <- err
+				return
+			}
+			expected := fmt.Sprintf("Dear |%s|,|TOWEL|GUIDE %d", name, i)
+			if actual := texts(writtenFiles(t, d)["word/document.xml"]); actual != expected {
+				errs <- fmt.Errorf("expected %q, got %q", expected, actual)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestTemplateRenderCanceled(t *testing.T) {
+	r := openTestPackage(t, map[string]string{
+		"word/document.xml": testDocumentStart + `<w:p><w:r><w:t>«name»</w:t></w:r></w:p>` + testDocumentEnd,
+	})
+	template, err := docx.NewTemplate(r, docx.RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := template.Render(ctx, map[string]string{"name": "Arthur"}); err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected the render to be canceled, got %v", err)
+	}
+
+	if _, err := docx.NewTemplate(r, docx.RenderOptions{Locale: "xx-unknown"}); err == nil {
+		t.Error("expected an error for an unknown locale")
+	}
+}
@@ -0,0 +1,282 @@
+package docx
+
+import (
+	"io"
+	"strings"
+	"xml"
+)
+
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// namespaces are the prefixes used when WordprocessingML is encoded again.
+var namespaces = [][2]string{
+	{"xmlns", "xmlns"},
+	{"wpc", "http://schemas.microsoft.com/office/word/2010/wordprocessingCanvas"},
+	{"mo", "http://schemas.microsoft.com/office/mac/office/2008/main"},
+	{"mc", "http://schemas.openxmlformats.org/markup-compatibility/2006"},
+	{"mv", "urn:schemas-microsoft-com:mac:vml"},
+	{"o", "urn:schemas-microsoft-com:office:office"},
+	{"r", "http://schemas.openxmlformats.org/officeDocument/2006/relationships"},
+	{"m", "http://schemas.openxmlformats.org/officeDocument/2006/math"},
+	{"v", "urn:schemas-microsoft-com:vml"},
+	{"wp14", "http://schemas.microsoft.com/office/word/2010/wordprocessingDrawing"},
+	{"wp", "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"},
+	{"w10", "urn:schemas-microsoft-com:office:word"},
+	{"w", wordNamespace},
+	{"w14", "http://schemas.microsoft.com/office/word/2010/wordml"},
+	{"w15", "http://schemas.microsoft.com/office/word/2012/wordml"},
+	{"wpg", "http://schemas.microsoft.com/office/word/2010/wordprocessingGroup"},
+	{"wpi", "http://schemas.microsoft.com/office/word/2010/wordprocessingInk"},
+	{"wne", "http://schemas.microsoft.com/office/word/2006/wordml"},
+	{"wps", "http://schemas.microsoft.com/office/word/2010/wordprocessingShape"},
+	{"a", "http://schemas.openxmlformats.org/drawingml/2006/main"},
+	{"pic", "http://schemas.openxmlformats.org/drawingml/2006/picture"},
+}
+
+// namespacePrefixes maps the namespaces of newEncoder to their prefixes.
+var namespacePrefixes = func() map[string]string {
+	prefixes := make(map[string]string)
+	for _, ns := range namespaces {
+		prefixes[ns[1]] = ns[0]
+	}
+	return prefixes
+}()
+
+// namespaceScope maps the prefixes declared by the ancestors of an element to their namespaces.
+type namespaceScope map[string]string
+
+// declare prepares a start element for the encoder and returns the scope of its children.
+// Default namespace declarations are dropped: the encoder writes the namespace of
+// elements without prefix itself and would write it twice. The prefixes the encoder
+// uses for the element and its attributes are declared unless the scope declares them,
+// as parts do not have to declare all of them on their root element.
+func (scope namespaceScope) declare(start xml.StartElement) (xml.StartElement, namespaceScope) {
+	inner, copied := scope, false
+	set := func(prefix, ns string) {
+		if !copied {
+			inner, copied = make(namespaceScope, len(scope)+1), true
+			for p, n := range scope {
+				inner[p] = n
+			}
+		}
+		inner[prefix] = ns
+	}
+	result := start
+	result.Attr = nil
+	for _, a := range start.Attr {
+		if a.Name.Space == "" && a.Name.Local == "xmlns" {
+			continue
+		}
+		if a.Name.Space == "xmlns" {
+			set(a.Name.Local, a.Value)
+		}
+		result.Attr = append(result.Attr, a)
+	}
+	used := []string{start.Name.Space}
+	for _, a := range start.Attr {
+		used = append(used, a.Name.Space)
+	}
+	for _, ns := range used {
+		prefix, ok := namespacePrefixes[ns]
+		if !ok || prefix == "xmlns" || inner[prefix] == ns {
+			continue
+		}
+		declaration := xml.Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: ns}
+		replaced := false
+		for i, a := range result.Attr {
+			if a.Name == declaration.Name {
+				result.Attr[i], replaced = declaration, true
+			}
+		}
+		if !replaced {
+			result.Attr = append(result.Attr, declaration)
+		}
+		set(prefix, ns)
+	}
+	return result, inner
+}
+
+// newEncoder returns an encoder that writes WordprocessingML
+// with the usual namespace prefixes.
+func newEncoder(w io.Writer) *xml.Encoder {
+	encoder := xml.NewEncoder(w)
+	encoder.OptimizeNamespaces(true)
+	encoder.PrefixElements(true)
+	for _, ns := range namespaces {
+		encoder.Namespace(ns[0], ns[1])
+	}
+	return encoder
+}
+
+// element is an XML element together with its children.
+// A child is either a plain token (xml.CharData, xml.Comment, ...)
+// or a nested *element.
+type element struct {
+	xml.StartElement
+	children []xml.Token
+}
+
+// newWordElement creates an empty element in the WordprocessingML namespace.
+func newWordElement(local string, attrs ...xml.Attr) *element {
+	return &element{StartElement: xml.StartElement{Name: xml.Name{Space: wordNamespace, Local: local}, Attr: attrs}}
+}
+
+// newTextElement creates a <w:t> element holding text.
+func newTextElement(text string) *element {
+	t := newWordElement("t")
+	if strings.TrimSpace(text) != text {
+		t.Attr = append(t.Attr, xml.Attr{Name: xml.Name{Space: xmlNamespace, Local: "space"}, Value: "preserve"})
+	}
+	t.children = []xml.Token{xml.CharData(text)}
+	return t
+}
+
+// is reports whether the element is the WordprocessingML element with the given local name.
+func (e *element) is(local string) bool {
+	return e.Name.Space == wordNamespace && e.Name.Local == local
+}
+
+// child returns the first child element with the given local name.
+func (e *element) child(local string) *element {
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok && el.is(local) {
+			return el
+		}
+	}
+	return nil
+}
+
+// text returns the content of all <w:t> elements below e.
+func (e *element) text() string {
+	var b strings.Builder
+	e.writeText(&b)
+	return b.String()
+}
+
+func (e *element) writeText(b *strings.Builder) {
+	for _, c := range e.children {
+		switch node := c.(type) {
+		case xml.CharData:
+			if e.is("t") {
+				b.Write(node)
+			}
+		case *element:
+			node.writeText(b)
+		}
+	}
+}
+
+// hasText reports whether there is a <w:t> element below e.
+func (e *element) hasText() bool {
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok && (el.is("t") || el.hasText()) {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns a deep copy of the element.
+func (e *element) copy() *element {
+	return &element{StartElement: e.StartElement.Copy(), children: copyTree(e.children)}
+}
+
+// copyTree returns a deep copy of a token tree.
+func copyTree(nodes []xml.Token) []xml.Token {
+	result := make([]xml.Token, len(nodes))
+	for i, n := range nodes {
+		if el, ok := n.(*element); ok {
+			result[i] = el.copy()
+		} else {
+			result[i] = xml.CopyToken(n)
+		}
+	}
+	return result
+}
+
+// readTokens decodes all tokens of an XML document.
+func readTokens(content string) (tokens []xml.Token, err error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	for {
+		var t xml.Token
+		t, err = decoder.Token()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+}
+
+// buildTree turns a well-formed token stream into a token tree.
+func buildTree(tokens []xml.Token) []xml.Token {
+	var root []xml.Token
+	var stack []*element
+	add := func(t xml.Token) {
+		if len(stack) == 0 {
+			root = append(root, t)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, t)
+		}
+	}
+	for _, t := range tokens {
+		switch node := t.(type) {
+		case xml.StartElement:
+			el := &element{StartElement: node}
+			add(el)
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			add(t)
+		}
+	}
+	return root
+}
+
+// encodeTree writes a token tree to the encoder.
+func encodeTree(encoder *xml.Encoder, nodes []xml.Token) error {
+	return encodeTreeIn(encoder, nodes, nil)
+}
+
+// encodeTreeIn writes a token tree whose parent declares the given prefixes.
+func encodeTreeIn(encoder *xml.Encoder, nodes []xml.Token, scope namespaceScope) error {
+	for _, n := range nodes {
+		if el, ok := n.(*element); ok {
+			start, inner := scope.declare(el.StartElement)
+			if err := encoder.EncodeToken(start); err != nil {
+				return err
+			}
+			if err := encodeTreeIn(encoder, el.children, inner); err != nil {
+				return err
+			}
+			if err := encoder.EncodeToken(el.End()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := encoder.EncodeToken(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeString encodes a token tree as WordprocessingML.
+func encodeString(nodes []xml.Token) (string, error) {
+	var b strings.Builder
+	encoder := newEncoder(&b)
+	if err := encodeTree(encoder, nodes); err != nil {
+		return "", err
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}